@@ -7,10 +7,13 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	"log/slog"
 	"os"
 	"testing"
+	"time"
 )
 
 var port uint16 = 50051
@@ -21,7 +24,7 @@ func TestMain(m *testing.M) {
 	svc := service.NewServiceMock()
 	svc = service.NewServiceLogging(svc, log)
 	go func() {
-		err := Serve(port, svc)
+		err := Serve(context.TODO(), port, 0, svc)
 		if err != nil {
 			log.Error(err.Error())
 		}
@@ -48,12 +51,112 @@ func TestServiceClient_SearchAndAdd(t *testing.T) {
 			},
 			n: 42,
 		},
+		"accounts": {
+			req: &SearchAndAddRequest{
+				Q:    "ok",
+				Type: SearchType_SearchTypeAccounts,
+			},
+			n: 42,
+		},
+		"unknown type": {
+			req: &SearchAndAddRequest{
+				Q:    "ok",
+				Type: 2,
+			},
+			err: status.Error(codes.InvalidArgument, "unknown search type"),
+		},
+	}
+	//
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			resp, err := client.SearchAndAdd(context.TODO(), c.req)
+			assert.ErrorIs(t, err, c.err)
+			if c.err == nil {
+				assert.Equal(t, c.n, resp.N)
+			}
+		})
+	}
+}
+
+func TestServiceClient_Search(t *testing.T) {
+	//
+	addr := fmt.Sprintf("localhost:%d", port)
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.Nil(t, err)
+	client := NewServiceClient(conn)
+	//
+	resp, err := client.Search(context.TODO(), &SearchRequest{
+		Q:     "ok",
+		Limit: 10,
+		Type:  SearchType_SearchTypeAccounts,
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Candidates, 2)
+	assert.Equal(t, "https://host1/users/john", resp.Candidates[0].AccountUri)
+	assert.True(t, resp.Candidates[0].Accepted)
+	assert.False(t, resp.Candidates[1].Accepted)
+	assert.Equal(t, "noindex", resp.Candidates[1].Reason)
+}
+
+func TestServiceClient_ListSources(t *testing.T) {
+	//
+	addr := fmt.Sprintf("localhost:%d", port)
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.Nil(t, err)
+	client := NewServiceClient(conn)
+	//
+	resp, err := client.ListSources(context.TODO(), &ListSourcesRequest{
+		SubId: "interest1",
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Sources, 1)
+	assert.Equal(t, "interest1", resp.Sources[0].SubId)
+	assert.Equal(t, "delegated", resp.Sources[0].Outcome)
+	assert.Equal(t, time.Date(2024, 12, 20, 10, 40, 15, 0, time.UTC), resp.Sources[0].Time.AsTime())
+}
+
+func TestServiceClient_RemoveSources(t *testing.T) {
+	//
+	addr := fmt.Sprintf("localhost:%d", port)
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.Nil(t, err)
+	client := NewServiceClient(conn)
+	//
+	cases := map[string]struct {
+		req *RemoveSourcesRequest
+		n   uint32
+		err error
+	}{
+		"statuses": {
+			req: &RemoveSourcesRequest{
+				SubId: "interest1",
+			},
+			n: 1,
+		},
+		"accounts": {
+			req: &RemoveSourcesRequest{
+				SubId: "interest1",
+				Q:     "interest1@ap.host",
+				Type:  SearchType_SearchTypeAccounts,
+			},
+			n: 1,
+		},
+		"accounts w/o actor": {
+			req: &RemoveSourcesRequest{
+				SubId: "interest1",
+				Type:  SearchType_SearchTypeAccounts,
+			},
+			err: status.Error(codes.InvalidArgument, "actor address is required for the accounts search type"),
+		},
 	}
 	//
 	for k, c := range cases {
 		t.Run(k, func(t *testing.T) {
-			_, err := client.SearchAndAdd(context.TODO(), c.req)
+			resp, err := client.RemoveSources(context.TODO(), c.req)
 			assert.ErrorIs(t, err, c.err)
+			if c.err == nil {
+				assert.Equal(t, c.n, resp.N)
+			}
 		})
 	}
 }
@@ -4,6 +4,9 @@ import (
 	"context"
 	"github.com/awakari/int-mastodon/model"
 	"github.com/awakari/int-mastodon/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type controller struct {
@@ -18,6 +21,77 @@ func NewController(search service.Service) ServiceServer {
 
 func (c controller) SearchAndAdd(ctx context.Context, req *SearchAndAddRequest) (resp *SearchAndAddResponse, err error) {
 	resp = &SearchAndAddResponse{}
-	resp.N, err = c.search.SearchAndAdd(ctx, req.SubId, req.GroupId, req.Q, req.Limit, model.SearchTypeStatuses)
+	var typ model.SearchType
+	typ, err = searchType(req.Type)
+	if err == nil {
+		resp.N, err = c.search.SearchAndAdd(ctx, req.SubId, req.GroupId, req.Q, req.Limit, typ)
+	}
+	return
+}
+
+func (c controller) Search(ctx context.Context, req *SearchRequest) (resp *SearchResponse, err error) {
+	resp = &SearchResponse{}
+	var typ model.SearchType
+	typ, err = searchType(req.Type)
+	var candidates []model.Candidate
+	if err == nil {
+		candidates, err = c.search.Search(ctx, req.Q, req.Limit, typ)
+	}
+	for _, cand := range candidates {
+		resp.Candidates = append(resp.Candidates, &Candidate{
+			AccountUri: cand.AccountUri,
+			StatusUri:  cand.StatusUri,
+			Host:       cand.Host,
+			Accepted:   cand.Decision.Accepted,
+			Reason:     cand.Decision.Reason.String(),
+			Detail:     cand.Decision.Detail,
+		})
+	}
+	return
+}
+
+func (c controller) ListSources(ctx context.Context, req *ListSourcesRequest) (resp *ListSourcesResponse, err error) {
+	resp = &ListSourcesResponse{}
+	var srcs []model.Source
+	srcs, err = c.search.ListSources(ctx, req.SubId)
+	for _, src := range srcs {
+		resp.Sources = append(resp.Sources, &Source{
+			AccountUri: src.AccountUri,
+			Host:       src.Host,
+			SubId:      src.InterestId,
+			GroupId:    src.GroupId,
+			Q:          src.Query,
+			Time:       timestamppb.New(src.Time),
+			Outcome:    src.Outcome.String(),
+			Reason:     src.Decision.Reason.String(),
+			Detail:     src.Decision.Detail,
+			Error:      src.Error,
+		})
+	}
+	return
+}
+
+func (c controller) RemoveSources(ctx context.Context, req *RemoveSourcesRequest) (resp *RemoveSourcesResponse, err error) {
+	resp = &RemoveSourcesResponse{}
+	var typ model.SearchType
+	typ, err = searchType(req.Type)
+	if err == nil && typ == model.SearchTypeAccounts && req.Q == "" {
+		err = status.Error(codes.InvalidArgument, "actor address is required for the accounts search type")
+	}
+	if err == nil {
+		resp.N, err = c.search.RemoveSources(ctx, req.SubId, req.GroupId, req.Q, typ)
+	}
+	return
+}
+
+func searchType(src SearchType) (dst model.SearchType, err error) {
+	switch src {
+	case SearchType_SearchTypeStatuses:
+		dst = model.SearchTypeStatuses
+	case SearchType_SearchTypeAccounts:
+		dst = model.SearchTypeAccounts
+	default:
+		err = status.Error(codes.InvalidArgument, "unknown search type")
+	}
 	return
 }
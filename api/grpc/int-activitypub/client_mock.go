@@ -21,6 +21,21 @@ func (cm clientMock) Create(ctx context.Context, req *CreateRequest, opts ...grp
 	switch req.Addr {
 	case "fail":
 		err = status.Error(codes.Internal, "internal failure")
+	case "conflict":
+		err = status.Error(codes.AlreadyExists, "already exists")
+	}
+	return
+}
+
+func (cm clientMock) Delete(ctx context.Context, req *DeleteRequest, opts ...grpc.CallOption) (resp *DeleteResponse, err error) {
+	resp = &DeleteResponse{}
+	switch req.Addr {
+	case "fail":
+		err = status.Error(codes.Internal, "internal failure")
+	case "missing":
+		err = status.Error(codes.NotFound, "not found")
+	case "unsupported":
+		err = status.Error(codes.Unimplemented, "unsupported")
 	}
 	return
 }
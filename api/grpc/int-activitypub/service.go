@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Service interface {
 	Create(ctx context.Context, addr, groupId, userId, subId, term string) (err error)
+	Delete(ctx context.Context, addr, groupId, userId, subId string) (err error)
 }
 
 type service struct {
@@ -16,6 +19,9 @@ type service struct {
 
 var ErrInternal = errors.New("internal failure")
 
+// ErrInvalid means the request is not supported or is not valid, so it fails the same way on the retry.
+var ErrInvalid = errors.New("invalid request")
+
 func NewService(client ServiceClient) Service {
 	return service{
 		client: client,
@@ -27,8 +33,37 @@ func (svc service) Create(ctx context.Context, addr, groupId, userId, subId, ter
 		Addr:    addr,
 		GroupId: groupId,
 		UserId:  userId,
+		SubId:   subId,
+		Term:    term,
+	})
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.AlreadyExists:
+		// already followed
+		err = nil
+	case codes.InvalidArgument, codes.Unimplemented:
+		err = fmt.Errorf("%w: %s", ErrInvalid, err)
+	default:
+		err = fmt.Errorf("%w: %s", ErrInternal, err)
+	}
+	return
+}
+
+func (svc service) Delete(ctx context.Context, addr, groupId, userId, subId string) (err error) {
+	_, err = svc.client.Delete(ctx, &DeleteRequest{
+		Addr:    addr,
+		GroupId: groupId,
+		UserId:  userId,
+		SubId:   subId,
 	})
-	if err != nil {
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.NotFound:
+		// already deleted
+		err = nil
+	case codes.InvalidArgument, codes.Unimplemented:
+		err = fmt.Errorf("%w: %s", ErrInvalid, err)
+	default:
 		err = fmt.Errorf("%w: %s", ErrInternal, err)
 	}
 	return
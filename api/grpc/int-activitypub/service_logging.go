@@ -24,3 +24,9 @@ func (sl svcLogging) Create(ctx context.Context, addr, groupId, userId, subId, t
 	sl.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("int-activitypub.Create(%s, %s, %s, %s, %s): %s", addr, groupId, userId, subId, term, err))
 	return
 }
+
+func (sl svcLogging) Delete(ctx context.Context, addr, groupId, userId, subId string) (err error) {
+	err = sl.svc.Delete(ctx, addr, groupId, userId, subId)
+	sl.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("int-activitypub.Delete(%s, %s, %s, %s): %s", addr, groupId, userId, subId, err))
+	return
+}
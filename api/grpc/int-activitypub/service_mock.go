@@ -16,3 +16,11 @@ func (sm serviceMock) Create(ctx context.Context, addr, groupId, userId, subId,
 	}
 	return
 }
+
+func (sm serviceMock) Delete(ctx context.Context, addr, groupId, userId, subId string) (err error) {
+	switch {
+	case addr == "fail", subId == "fail":
+		err = ErrInternal
+	}
+	return
+}
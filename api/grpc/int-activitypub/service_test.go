@@ -19,6 +19,9 @@ func TestService_Create(t *testing.T) {
 		"ok": {
 			addr: "addr1",
 		},
+		"already exists": {
+			addr: "conflict",
+		},
 		"fail": {
 			addr: "fail",
 			err:  ErrInternal,
@@ -31,3 +34,35 @@ func TestService_Create(t *testing.T) {
 		})
 	}
 }
+
+func TestService_Delete(t *testing.T) {
+	svc := NewService(NewClientMock())
+	cases := map[string]struct {
+		addr    string
+		groupId string
+		userId  string
+		subId   string
+		err     error
+	}{
+		"ok": {
+			addr: "addr1",
+		},
+		"missing": {
+			addr: "missing",
+		},
+		"unsupported": {
+			addr: "unsupported",
+			err:  ErrInvalid,
+		},
+		"fail": {
+			addr: "fail",
+			err:  ErrInternal,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			err := svc.Delete(context.TODO(), c.addr, c.groupId, c.userId, c.subId)
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
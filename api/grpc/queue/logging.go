@@ -27,7 +27,7 @@ func (l logging) SetConsumer(ctx context.Context, name, subj string) (err error)
 	return
 }
 
-func (l logging) ReceiveMessages(ctx context.Context, queue, subj string, batchSize uint32, consume util.ConsumeFunc[[]*pb.CloudEvent]) (err error) {
+func (l logging) ReceiveMessages(ctx context.Context, queue, subj string, batchSize uint32, consume util.ConsumeBatchFunc[*pb.CloudEvent]) (err error) {
 	err = l.svc.ReceiveMessages(ctx, queue, subj, batchSize, consume)
 	ll := util.LogLevel(err)
 	l.log.Log(ctx, ll, fmt.Sprintf("queue.ReceiveMessages(queue=%s, subj=%s, batchSize=%d): err=%s", queue, subj, batchSize, err))
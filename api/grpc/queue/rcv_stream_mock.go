@@ -49,8 +49,7 @@ func (rsm *rcvStreamMock) Recv() (resp *ReceiveMessagesResponse, err error) {
 
 func (rsm *rcvStreamMock) Send(req *ReceiveMessagesRequest) error {
 	start := req.GetStart()
-	switch {
-	case start != nil:
+	if start != nil {
 		rsm.queue = start.Queue
 	}
 	return nil
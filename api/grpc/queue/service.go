@@ -9,11 +9,15 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"io"
+	"sync"
 )
 
 type Service interface {
 	SetConsumer(ctx context.Context, name, subj string) (err error)
-	ReceiveMessages(ctx context.Context, queue, subj string, batchSize uint32, consume util.ConsumeFunc[[]*pb.CloudEvent]) (err error)
+	// ReceiveMessages feeds the received message batches to the consume function until the context is done.
+	// The consume function returns the count of the leading messages processed. Only these are acknowledged, and
+	// the receiving ends with ErrNotConsumed when there are any others, so the queue redelivers them.
+	ReceiveMessages(ctx context.Context, queue, subj string, batchSize uint32, consume util.ConsumeBatchFunc[*pb.CloudEvent]) (err error)
 }
 
 type service struct {
@@ -24,6 +28,8 @@ var ErrInternal = errors.New("queue: internal failure")
 
 var ErrQueueMissing = errors.New("missing queue")
 
+var ErrNotConsumed = errors.New("queue: messages not consumed")
+
 func NewService(client ServiceClient) Service {
 	return service{
 		client: client,
@@ -40,9 +46,22 @@ func (svc service) SetConsumer(ctx context.Context, name, subj string) (err erro
 	return
 }
 
-func (svc service) ReceiveMessages(ctx context.Context, queue, subj string, batchSize uint32, consume util.ConsumeFunc[[]*pb.CloudEvent]) (err error) {
+func (svc service) ReceiveMessages(ctx context.Context, queue, subj string, batchSize uint32, consume util.ConsumeBatchFunc[*pb.CloudEvent]) (err error) {
+	// the stream outlives the context until the in-flight batch is consumed and acknowledged
+	ctxStream, cancelStream := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelStream()
+	inFlight := &sync.Mutex{}
+	go func() {
+		select {
+		case <-ctx.Done():
+			inFlight.Lock()
+			cancelStream()
+			inFlight.Unlock()
+		case <-ctxStream.Done():
+		}
+	}()
 	var stream Service_ReceiveMessagesClient
-	stream, err = svc.client.ReceiveMessages(ctx)
+	stream, err = svc.client.ReceiveMessages(ctxStream)
 	if err != nil {
 		err = decodeError(ctx, err)
 	}
@@ -63,6 +82,11 @@ func (svc service) ReceiveMessages(ctx context.Context, queue, subj string, batc
 		var resp *ReceiveMessagesResponse
 		for {
 			resp, err = stream.Recv()
+			if ctx.Err() != nil {
+				// not consumed messages are redelivered
+				err = ctx.Err()
+				break
+			}
 			if err == io.EOF {
 				err = nil
 				break
@@ -72,15 +96,31 @@ func (svc service) ReceiveMessages(ctx context.Context, queue, subj string, batc
 				break
 			}
 			if resp != nil {
-				err = errors.Join(err, consume(resp.Msgs))
-				req = &ReceiveMessagesRequest{
-					Command: &ReceiveMessagesRequest_Ack{
-						Ack: &ReceiveMessagesCommandAck{
-							Count: uint32(len(resp.Msgs)),
+				inFlight.Lock()
+				// the consume error itself is ignored, the count of the processed messages decides what is acknowledged
+				countAck, _ := consume(resp.Msgs)
+				countMsgs := uint32(len(resp.Msgs))
+				if countAck > countMsgs {
+					countAck = countMsgs
+				}
+				if countAck > 0 {
+					req = &ReceiveMessagesRequest{
+						Command: &ReceiveMessagesRequest_Ack{
+							Ack: &ReceiveMessagesCommandAck{
+								Count: countAck,
+							},
 						},
-					},
+					}
+					err = stream.Send(req)
+				}
+				inFlight.Unlock()
+				switch {
+				case err != nil:
+					err = decodeError(ctx, err)
+				case countAck < countMsgs:
+					// the queue has no negative acknowledgement, end the stream to get the rest redelivered
+					err = fmt.Errorf("%w: %d of %d", ErrNotConsumed, countMsgs-countAck, countMsgs)
 				}
-				err = errors.Join(err, stream.Send(req))
 			}
 			if err == nil {
 				select {
@@ -26,7 +26,7 @@ func (sm serviceMock) SetConsumer(ctx context.Context, name, subj string) (err e
 	return
 }
 
-func (sm serviceMock) ReceiveMessages(ctx context.Context, queue, subj string, batchSize uint32, consume util.ConsumeFunc[[]*pb.CloudEvent]) (err error) {
+func (sm serviceMock) ReceiveMessages(ctx context.Context, queue, subj string, batchSize uint32, consume util.ConsumeBatchFunc[*pb.CloudEvent]) (err error) {
 	switch {
 	case queue == "fail":
 		err = ErrInternal
@@ -48,7 +48,7 @@ func (sm serviceMock) ReceiveMessages(ctx context.Context, queue, subj string, b
 			}
 			msgs = append(msgs, &msg)
 		}
-		_ = consume(msgs)
+		_, _ = consume(msgs)
 	}
 	return
 }
@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"errors"
 	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
 	"github.com/stretchr/testify/assert"
 	"log/slog"
@@ -59,8 +60,9 @@ func TestService_ReceiveMessages(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
 			defer cancel()
 			var msgs []*pb.CloudEvent
-			consume := func(msgBatch []*pb.CloudEvent) (err error) {
+			consume := func(msgBatch []*pb.CloudEvent) (count uint32, err error) {
 				msgs = append(msgs, msgBatch...)
+				count = uint32(len(msgBatch))
 				return
 			}
 			err := svc.ReceiveMessages(ctx, k, k, 10, consume)
@@ -70,3 +72,23 @@ func TestService_ReceiveMessages(t *testing.T) {
 		})
 	}
 }
+
+func TestService_ReceiveMessages_NotConsumed(t *testing.T) {
+	svc := NewService(newClientMock(100, 0))
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	var received []string
+	consume := func(msgBatch []*pb.CloudEvent) (count uint32, err error) {
+		for _, msg := range msgBatch {
+			received = append(received, msg.Id)
+		}
+		// fail to process all except the 1st message
+		count = 1
+		err = errors.New("consume failure")
+		return
+	}
+	err := svc.ReceiveMessages(ctx, "queue1", "subj1", 10, consume)
+	assert.ErrorIs(t, err, ErrNotConsumed)
+	// the receiving stops after the 1st batch so the queue redelivers the not acknowledged messages
+	assert.Equal(t, []string{"msg0", "msg1", "msg2"}, received)
+}
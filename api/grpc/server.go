@@ -1,6 +1,7 @@
 package grpc
 
 import (
+	"context"
 	"fmt"
 	"github.com/awakari/int-mastodon/service"
 	"google.golang.org/grpc"
@@ -8,16 +9,34 @@ import (
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"net"
+	"time"
 )
 
-func Serve(port uint16, search service.Service) (err error) {
+// Serve runs the gRPC server until the context is done. Then reports NOT_SERVING health status and stops gracefully
+// after the drain delay, so the load balancers have time to stop routing the new requests here.
+func Serve(ctx context.Context, port uint16, drainDelay time.Duration, search service.Service) (err error) {
 	srv := grpc.NewServer()
 	c := NewController(search)
 	RegisterServiceServer(srv, c)
 	reflection.Register(srv)
-	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	srvHealth := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, srvHealth)
 	conn, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err == nil {
+		stopped := make(chan struct{})
+		defer close(stopped)
+		go func() {
+			select {
+			case <-ctx.Done():
+				srvHealth.Shutdown()
+				select {
+				case <-time.After(drainDelay):
+				case <-stopped:
+				}
+				srv.GracefulStop()
+			case <-stopped:
+			}
+		}()
 		err = srv.Serve(conn)
 	}
 	return
@@ -0,0 +1,173 @@
+package mastodon
+
+import (
+	"context"
+	"fmt"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/bytedance/sonic"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Client is the Mastodon REST API client. Every method takes the host (e.g. "mastodon.social") and the access token
+// of the user the request is made on behalf of. The unsuccessful response is returned as ApiError.
+type Client interface {
+
+	// Search finds the statuses or the accounts, the resolve flag enables the WebFinger lookup of the remote ones.
+	// The statuses are paged by the max_id and min_id cursors, the accounts by the offset. The search response has no
+	// "Link" header, so the statuses links are derived from the first and the last status ids.
+	Search(ctx context.Context, host, token, q string, typ model.SearchType, resolve bool, offset uint32, page Page) (results model.Results, links Links, err error)
+
+	// Follow follows the account by its id local to the host. The locked account follow is pending as requested.
+	Follow(ctx context.Context, host, token, accId string) (rel model.Relationship, err error)
+
+	Unfollow(ctx context.Context, host, token, accId string) (rel model.Relationship, err error)
+
+	Relationships(ctx context.Context, host, token string, accIds []string) (rels []model.Relationship, err error)
+
+	// LookupAccount returns the account by its acct, e.g. "john" or "john@example.com", without the WebFinger lookup.
+	LookupAccount(ctx context.Context, host, token, acct string) (acc model.Account, err error)
+
+	// AccountStatuses returns the account's statuses, the newest first, and the links to the adjacent pages.
+	AccountStatuses(ctx context.Context, host, token, accId string, page Page) (sts []model.Status, links Links, err error)
+
+	// TagTimeline returns the public statuses having the hashtag (without "#"), the newest first, and the links to the
+	// adjacent pages.
+	TagTimeline(ctx context.Context, host, token, tag string, page Page) (sts []model.Status, links Links, err error)
+}
+
+// Page selects the statuses by their ids: older than MaxId, newer than SinceId or immediately newer than MinId.
+// Any may be empty, the zero Limit means the server default.
+type Page struct {
+	MaxId   string
+	SinceId string
+	MinId   string
+	Limit   uint32
+}
+
+type client struct {
+	clientHttp   *http.Client
+	userAgent    string
+	protocol     string
+	pathAccounts string
+	pathSearch   string
+	pathTags     string
+}
+
+const limitRespBodyLen = 1_048_576
+const limitRespBodyLenErr = 1_024
+
+func NewClient(clientHttp *http.Client, userAgent, protocol, pathAccounts, pathSearch, pathTags string) Client {
+	return client{
+		clientHttp:   clientHttp,
+		userAgent:    userAgent,
+		protocol:     protocol,
+		pathAccounts: pathAccounts,
+		pathSearch:   pathSearch,
+		pathTags:     pathTags,
+	}
+}
+
+func (c client) Search(ctx context.Context, host, token, q string, typ model.SearchType, resolve bool, offset uint32, page Page) (results model.Results, links Links, err error) {
+	query := page.query()
+	query.Set("q", q)
+	query.Set("type", typ.String())
+	query.Set("resolve", strconv.FormatBool(resolve))
+	query.Set("offset", strconv.FormatUint(uint64(offset), 10))
+	links, err = c.request(ctx, http.MethodGet, host, token, c.pathSearch, query, &results)
+	if err == nil && links == (Links{}) && len(results.Statuses) > 0 {
+		links.Next = Page{
+			MaxId: results.Statuses[len(results.Statuses)-1].Id,
+			MinId: page.MinId,
+			Limit: page.Limit,
+		}
+		links.Prev = Page{
+			MinId: results.Statuses[0].Id,
+			Limit: page.Limit,
+		}
+	}
+	return
+}
+
+func (c client) Follow(ctx context.Context, host, token, accId string) (rel model.Relationship, err error) {
+	_, err = c.request(ctx, http.MethodPost, host, token, c.pathAccounts+"/"+url.PathEscape(accId)+"/follow", nil, &rel)
+	return
+}
+
+func (c client) Unfollow(ctx context.Context, host, token, accId string) (rel model.Relationship, err error) {
+	_, err = c.request(ctx, http.MethodPost, host, token, c.pathAccounts+"/"+url.PathEscape(accId)+"/unfollow", nil, &rel)
+	return
+}
+
+func (c client) Relationships(ctx context.Context, host, token string, accIds []string) (rels []model.Relationship, err error) {
+	_, err = c.request(ctx, http.MethodGet, host, token, c.pathAccounts+"/relationships", url.Values{"id[]": accIds}, &rels)
+	return
+}
+
+func (c client) LookupAccount(ctx context.Context, host, token, acct string) (acc model.Account, err error) {
+	_, err = c.request(ctx, http.MethodGet, host, token, c.pathAccounts+"/lookup", url.Values{"acct": {acct}}, &acc)
+	return
+}
+
+func (c client) AccountStatuses(ctx context.Context, host, token, accId string, page Page) (sts []model.Status, links Links, err error) {
+	links, err = c.request(ctx, http.MethodGet, host, token, c.pathAccounts+"/"+url.PathEscape(accId)+"/statuses", page.query(), &sts)
+	return
+}
+
+func (c client) TagTimeline(ctx context.Context, host, token, tag string, page Page) (sts []model.Status, links Links, err error) {
+	links, err = c.request(ctx, http.MethodGet, host, token, c.pathTags+"/"+url.PathEscape(tag), page.query(), &sts)
+	return
+}
+
+func (c client) request(ctx context.Context, method, host, token, path string, query url.Values, out any) (links Links, err error) {
+	u := c.protocol + host + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, method, u, nil)
+	var resp *http.Response
+	if err == nil {
+		req.Header.Add("Accept", "application/json")
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("User-Agent", c.userAgent)
+		resp, err = c.clientHttp.Do(req)
+	}
+	if err == nil {
+		defer resp.Body.Close()
+		var data []byte
+		switch resp.StatusCode / 100 {
+		case 2:
+			links = parseLinks(resp.Header.Get("Link"))
+			data, err = io.ReadAll(io.LimitReader(resp.Body, limitRespBodyLen))
+			if err == nil {
+				if errUnmarshal := sonic.Unmarshal(data, out); errUnmarshal != nil {
+					err = fmt.Errorf("%w: %s %s%s %d: %s", ErrUnexpectedResponse, method, host, path, resp.StatusCode, errUnmarshal)
+				}
+			}
+		default:
+			data, _ = io.ReadAll(io.LimitReader(resp.Body, limitRespBodyLenErr))
+			err = newApiError(req, resp.StatusCode, data)
+		}
+	}
+	return
+}
+
+func (p Page) query() (q url.Values) {
+	q = url.Values{}
+	if p.MaxId != "" {
+		q.Set("max_id", p.MaxId)
+	}
+	if p.SinceId != "" {
+		q.Set("since_id", p.SinceId)
+	}
+	if p.MinId != "" {
+		q.Set("min_id", p.MinId)
+	}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.FormatUint(uint64(p.Limit), 10))
+	}
+	return
+}
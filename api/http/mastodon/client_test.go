@@ -0,0 +1,190 @@
+package mastodon
+
+import (
+	"context"
+	"errors"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) (c Client, host string) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") != "Bearer token1":
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"The access token is invalid"}`))
+		default:
+			assert.Equal(t, "test", r.Header.Get("User-Agent"))
+			h(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c = NewClient(http.DefaultClient, "test", "http://", "/api/v1/accounts", "/api/v2/search", "/api/v1/timelines/tag")
+	host = strings.TrimPrefix(srv.URL, "http://")
+	return
+}
+
+func TestClient_Search(t *testing.T) {
+	c, host := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("q") {
+		case "html":
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`<html><body>502 Bad Gateway</body></html>`))
+		case "proxy":
+			_, _ = w.Write([]byte(`<html><body>maintenance</body></html>`))
+		default:
+			assert.Equal(t, "/api/v2/search", r.URL.Path)
+			assert.Equal(t, "statuses", r.URL.Query().Get("type"))
+			assert.Equal(t, "true", r.URL.Query().Get("resolve"))
+			assert.Equal(t, "2", r.URL.Query().Get("offset"))
+			assert.Equal(t, "3", r.URL.Query().Get("limit"))
+			assert.Equal(t, "9", r.URL.Query().Get("max_id"))
+			_, _ = w.Write([]byte(`{"statuses":[{"id":"8","uri":"https://host1/statuses/8"},{"id":"5","uri":"https://host1/statuses/5"}],"accounts":[]}`))
+		}
+	})
+	cases := map[string]struct {
+		token   string
+		q       string
+		results model.Results
+		links   Links
+		err     error
+	}{
+		"ok": {
+			token: "token1",
+			q:     "foo bar&baz",
+			results: model.Results{
+				Statuses: []model.Status{
+					{
+						Id:  "8",
+						Uri: "https://host1/statuses/8",
+					},
+					{
+						Id:  "5",
+						Uri: "https://host1/statuses/5",
+					},
+				},
+				Accounts: []model.Account{},
+			},
+			links: Links{
+				Next: Page{
+					MaxId: "5",
+					Limit: 3,
+				},
+				Prev: Page{
+					MinId: "8",
+					Limit: 3,
+				},
+			},
+		},
+		"api error": {
+			token: "token2",
+			q:     "foo",
+			err: ApiError{
+				Method:     http.MethodGet,
+				Url:        "http://" + host + "/api/v2/search",
+				StatusCode: http.StatusUnauthorized,
+				Message:    "The access token is invalid",
+			},
+		},
+		"html error": {
+			token: "token1",
+			q:     "html",
+			err: ApiError{
+				Method:     http.MethodGet,
+				Url:        "http://" + host + "/api/v2/search",
+				StatusCode: http.StatusBadGateway,
+				Message:    "Bad Gateway",
+			},
+		},
+		"unexpected response": {
+			token: "token1",
+			q:     "proxy",
+			err:   ErrUnexpectedResponse,
+		},
+	}
+	for k, cc := range cases {
+		t.Run(k, func(t *testing.T) {
+			results, links, err := c.Search(context.TODO(), host, cc.token, cc.q, model.SearchTypeStatuses, true, 2, Page{MaxId: "9", Limit: 3})
+			assert.Equal(t, cc.results, results)
+			assert.Equal(t, cc.links, links)
+			if cc.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, cc.err)
+			}
+		})
+	}
+}
+
+func TestClient_Accounts(t *testing.T) {
+	c, host := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/v1/accounts/123/follow":
+			_, _ = w.Write([]byte(`{"id":"123","following":false,"requested":true}`))
+		case "POST /api/v1/accounts/123/unfollow":
+			_, _ = w.Write([]byte(`{"id":"123"}`))
+		case "GET /api/v1/accounts/relationships":
+			assert.Equal(t, []string{"123", "456"}, r.URL.Query()["id[]"])
+			_, _ = w.Write([]byte(`[{"id":"123","following":true},{"id":"456","followed_by":true}]`))
+		case "GET /api/v1/accounts/lookup":
+			switch r.URL.Query().Get("acct") {
+			case "john@host2":
+				_, _ = w.Write([]byte(`{"id":"123","acct":"john@host2","uri":"https://host2/users/john"}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":"Record not found"}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	rel, err := c.Follow(context.TODO(), host, "token1", "123")
+	require.NoError(t, err)
+	assert.Equal(t, model.Relationship{Id: "123", Requested: true}, rel)
+	rel, err = c.Unfollow(context.TODO(), host, "token1", "123")
+	require.NoError(t, err)
+	assert.Equal(t, model.Relationship{Id: "123"}, rel)
+	rels, err := c.Relationships(context.TODO(), host, "token1", []string{"123", "456"})
+	require.NoError(t, err)
+	assert.Equal(t, []model.Relationship{{Id: "123", Following: true}, {Id: "456", FollowedBy: true}}, rels)
+	acc, err := c.LookupAccount(context.TODO(), host, "token1", "john@host2")
+	require.NoError(t, err)
+	assert.Equal(t, model.Account{Id: "123", Acct: "john@host2", Uri: "https://host2/users/john"}, acc)
+	_, err = c.LookupAccount(context.TODO(), host, "token1", "jane@host2")
+	var errApi ApiError
+	require.True(t, errors.As(err, &errApi))
+	assert.Equal(t, http.StatusNotFound, errApi.StatusCode)
+	assert.Equal(t, "Record not found", errApi.Message)
+	assert.Equal(t, "mastodon api GET http://"+host+"/api/v1/accounts/lookup: 404 Record not found", errApi.Error())
+}
+
+func TestClient_Statuses(t *testing.T) {
+	c, host := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/accounts/123/statuses":
+			assert.Equal(t, "max_id=9&limit=20", "max_id="+r.URL.Query().Get("max_id")+"&limit="+r.URL.Query().Get("limit"))
+			assert.False(t, r.URL.Query().Has("since_id"))
+			w.Header().Set("Link", `<http://`+r.Host+`/api/v1/accounts/123/statuses?limit=20&max_id=7>; rel="next", <http://`+r.Host+`/api/v1/accounts/123/statuses?limit=20&min_id=8>; rel="prev"`)
+			_, _ = w.Write([]byte(`[{"id":"8"},{"id":"7"}]`))
+		case "/api/v1/timelines/tag/caf%C3%A9", "/api/v1/timelines/tag/café":
+			assert.Equal(t, "5", r.URL.Query().Get("since_id"))
+			assert.Equal(t, "6", r.URL.Query().Get("min_id"))
+			_, _ = w.Write([]byte(`[{"id":"10"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	sts, links, err := c.AccountStatuses(context.TODO(), host, "token1", "123", Page{MaxId: "9", Limit: 20})
+	require.NoError(t, err)
+	assert.Equal(t, []model.Status{{Id: "8"}, {Id: "7"}}, sts)
+	assert.Equal(t, Links{Next: Page{MaxId: "7", Limit: 20}, Prev: Page{MinId: "8", Limit: 20}}, links)
+	sts, links, err = c.TagTimeline(context.TODO(), host, "token1", "café", Page{SinceId: "5", MinId: "6"})
+	require.NoError(t, err)
+	assert.Equal(t, []model.Status{{Id: "10"}}, sts)
+	assert.Equal(t, Links{}, links)
+}
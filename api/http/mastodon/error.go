@@ -0,0 +1,46 @@
+package mastodon
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bytedance/sonic"
+	"net/http"
+	"strings"
+)
+
+// ErrUnexpectedResponse means the successful response is not the expected JSON, e.g. the HTML page of the proxy.
+var ErrUnexpectedResponse = errors.New("unexpected mastodon response")
+
+// ApiError is the unsuccessful Mastodon API response, the body is {"error": "...", "error_description": "..."}.
+type ApiError struct {
+	Method      string
+	Url         string
+	StatusCode  int
+	Message     string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e ApiError) Error() (s string) {
+	s = fmt.Sprintf("mastodon api %s %s: %d", e.Method, e.Url, e.StatusCode)
+	if e.Message != "" {
+		s += " " + e.Message
+	}
+	if e.Description != "" {
+		s += ": " + e.Description
+	}
+	return
+}
+
+func newApiError(req *http.Request, statusCode int, data []byte) (e ApiError) {
+	// not the JSON, e.g. the HTML error page
+	if sonic.Unmarshal(data, &e) != nil || e.Message == "" {
+		e.Message = http.StatusText(statusCode)
+	}
+	e.Method = req.Method
+	e.StatusCode = statusCode
+	u := *req.URL
+	u.RawQuery = ""
+	e.Url = u.String()
+	e.Message = strings.TrimSpace(e.Message)
+	return
+}
@@ -0,0 +1,65 @@
+package mastodon
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Links are the cursors to the adjacent pages: Next to the older items (max_id), Prev to the newer ones (min_id).
+// The empty Page means there's no such page.
+type Links struct {
+	Next Page
+	Prev Page
+}
+
+const relNext = "next"
+const relPrev = "prev"
+
+// parseLinks reads the "Link" header value, e.g.:
+//
+//	<https://host/api/v1/timelines/tag/foo?max_id=2>; rel="next", <https://host/api/v1/timelines/tag/foo?min_id=9>; rel="prev"
+func parseLinks(v string) (links Links) {
+	for _, link := range strings.Split(v, ",") {
+		target, params, _ := strings.Cut(strings.TrimSpace(link), ";")
+		target = strings.TrimSpace(target)
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		u, err := url.Parse(target[1 : len(target)-1])
+		if err != nil {
+			continue
+		}
+		p := pageOf(u.Query())
+		for _, param := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.TrimSpace(k) != "rel" {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(v), `"`)) {
+				switch rel {
+				case relNext:
+					links.Next = p
+				case relPrev:
+					links.Prev = p
+				}
+			}
+		}
+	}
+	return
+}
+
+func pageOf(q url.Values) (p Page) {
+	p.MaxId = q.Get("max_id")
+	p.SinceId = q.Get("since_id")
+	p.MinId = q.Get("min_id")
+	if limit, err := strconv.ParseUint(q.Get("limit"), 10, 32); err == nil {
+		p.Limit = uint32(limit)
+	}
+	return
+}
+
+// Empty returns true when the page has no cursor.
+func (p Page) Empty() bool {
+	return p.MaxId == "" && p.SinceId == "" && p.MinId == ""
+}
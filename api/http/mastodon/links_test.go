@@ -0,0 +1,43 @@
+package mastodon
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	cases := map[string]struct {
+		in    string
+		links Links
+	}{
+		"empty": {},
+		"next and prev": {
+			in: `<https://host1/api/v1/timelines/tag/foo?max_id=2>; rel="next", <https://host1/api/v1/timelines/tag/foo?min_id=9>; rel="prev"`,
+			links: Links{
+				Next: Page{
+					MaxId: "2",
+				},
+				Prev: Page{
+					MinId: "9",
+				},
+			},
+		},
+		"next only with limit": {
+			in: `<https://host1/api/v1/accounts/1/statuses?limit=40&max_id=2>;rel=next`,
+			links: Links{
+				Next: Page{
+					MaxId: "2",
+					Limit: 40,
+				},
+			},
+		},
+		"other rel and malformed": {
+			in: `https://host1/?max_id=2; rel="next", <https://host1/?max_id=3>; rel="last"`,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.links, parseLinks(c.in))
+		})
+	}
+}
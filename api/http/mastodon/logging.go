@@ -0,0 +1,63 @@
+package mastodon
+
+import (
+	"context"
+	"fmt"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/awakari/int-mastodon/util"
+	"log/slog"
+)
+
+type logging struct {
+	c   Client
+	log *slog.Logger
+}
+
+func NewLogging(c Client, log *slog.Logger) Client {
+	return logging{
+		c:   c,
+		log: log,
+	}
+}
+
+func (l logging) Search(ctx context.Context, host, token, q string, typ model.SearchType, resolve bool, offset uint32, page Page) (results model.Results, links Links, err error) {
+	results, links, err = l.c.Search(ctx, host, token, q, typ, resolve, offset, page)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("mastodon.Search(host=%s, q=%s, typ=%s, resolve=%t, offset=%d, page=%+v): %d/%d, %+v, err=%s", host, q, typ, resolve, offset, page, len(results.Statuses), len(results.Accounts), links, err))
+	return
+}
+
+func (l logging) Follow(ctx context.Context, host, token, accId string) (rel model.Relationship, err error) {
+	rel, err = l.c.Follow(ctx, host, token, accId)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("mastodon.Follow(host=%s, accId=%s): %+v, err=%s", host, accId, rel, err))
+	return
+}
+
+func (l logging) Unfollow(ctx context.Context, host, token, accId string) (rel model.Relationship, err error) {
+	rel, err = l.c.Unfollow(ctx, host, token, accId)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("mastodon.Unfollow(host=%s, accId=%s): %+v, err=%s", host, accId, rel, err))
+	return
+}
+
+func (l logging) Relationships(ctx context.Context, host, token string, accIds []string) (rels []model.Relationship, err error) {
+	rels, err = l.c.Relationships(ctx, host, token, accIds)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("mastodon.Relationships(host=%s, accIds=%v): %d, err=%s", host, accIds, len(rels), err))
+	return
+}
+
+func (l logging) LookupAccount(ctx context.Context, host, token, acct string) (acc model.Account, err error) {
+	acc, err = l.c.LookupAccount(ctx, host, token, acct)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("mastodon.LookupAccount(host=%s, acct=%s): %s, err=%s", host, acct, acc.Uri, err))
+	return
+}
+
+func (l logging) AccountStatuses(ctx context.Context, host, token, accId string, page Page) (sts []model.Status, links Links, err error) {
+	sts, links, err = l.c.AccountStatuses(ctx, host, token, accId, page)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("mastodon.AccountStatuses(host=%s, accId=%s, page=%+v): %d, %+v, err=%s", host, accId, page, len(sts), links, err))
+	return
+}
+
+func (l logging) TagTimeline(ctx context.Context, host, token, tag string, page Page) (sts []model.Status, links Links, err error) {
+	sts, links, err = l.c.TagTimeline(ctx, host, token, tag, page)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("mastodon.TagTimeline(host=%s, tag=%s, page=%+v): %d, %+v, err=%s", host, tag, page, len(sts), links, err))
+	return
+}
@@ -0,0 +1,93 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bytedance/sonic"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter accepts the events failed to publish, for the later replay.
+type DeadLetter interface {
+	Put(ctx context.Context, evt *pb.CloudEvent, groupId, userId string, cause error) (err error)
+}
+
+// DeadLetterRecord is the single line of the dead-letter file.
+type DeadLetterRecord struct {
+	Time    time.Time       `json:"time"`
+	GroupId string          `json:"groupId"`
+	UserId  string          `json:"userId"`
+	Error   string          `json:"error"`
+	Event   json.RawMessage `json:"event"`
+}
+
+type deadLetterFile struct {
+	lock *sync.Mutex
+	path string
+}
+
+type deadLetterLog struct {
+	log *slog.Logger
+}
+
+// NewDeadLetterFile appends the failed events as JSON lines to the file at the specified path.
+func NewDeadLetterFile(path string) DeadLetter {
+	return deadLetterFile{
+		lock: &sync.Mutex{},
+		path: path,
+	}
+}
+
+// NewDeadLetterLog only logs the failed events, to be used when no dead-letter file is configured.
+func NewDeadLetterLog(log *slog.Logger) DeadLetter {
+	return deadLetterLog{
+		log: log,
+	}
+}
+
+func (dl deadLetterFile) Put(ctx context.Context, evt *pb.CloudEvent, groupId, userId string, cause error) (err error) {
+	var data []byte
+	data, err = marshalDeadLetter(evt, groupId, userId, cause)
+	if err == nil {
+		dl.lock.Lock()
+		defer dl.lock.Unlock()
+		var f *os.File
+		f, err = os.OpenFile(dl.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			defer f.Close()
+			_, err = f.Write(append(data, '\n'))
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to put the event %s to the dead-letter file %s: %w", evt.Id, dl.path, err)
+	}
+	return
+}
+
+func (dl deadLetterLog) Put(ctx context.Context, evt *pb.CloudEvent, groupId, userId string, cause error) (err error) {
+	var data []byte
+	data, err = marshalDeadLetter(evt, groupId, userId, cause)
+	if err == nil {
+		dl.log.Error(fmt.Sprintf("pub.DeadLetter: %s", string(data)))
+	}
+	return
+}
+
+func marshalDeadLetter(evt *pb.CloudEvent, groupId, userId string, cause error) (data []byte, err error) {
+	rec := DeadLetterRecord{
+		Time:    time.Now().UTC(),
+		GroupId: groupId,
+		UserId:  userId,
+		Error:   cause.Error(),
+	}
+	rec.Event, err = MarshalEvent(evt)
+	if err == nil {
+		data, err = sonic.Marshal(rec)
+	}
+	return
+}
@@ -0,0 +1,127 @@
+package pub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/int-mastodon/dedup"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+type dedupService struct {
+	svc        Service
+	stor       dedup.Storage
+	log        *slog.Logger
+	passed     *atomic.Uint64
+	suppressed *atomic.Uint64
+	interval   time.Duration
+	reported   *atomic.Int64
+}
+
+// NewDedup skips publishing the events for the statuses that were already published recently,
+// e.g. when the same remote status is received from the multiple hosts.
+// The suppressed/passed totals are logged at most once per the specified interval.
+func NewDedup(svc Service, stor dedup.Storage, interval time.Duration, log *slog.Logger) Service {
+	reported := &atomic.Int64{}
+	reported.Store(time.Now().UnixNano())
+	return dedupService{
+		svc:        svc,
+		stor:       stor,
+		log:        log,
+		passed:     &atomic.Uint64{},
+		suppressed: &atomic.Uint64{},
+		interval:   interval,
+		reported:   reported,
+	}
+}
+
+func (d dedupService) Publish(ctx context.Context, evt *pb.CloudEvent, groupId, userId string) (err error) {
+	k := dedupKey(evt)
+	var added bool
+	added, err = d.stor.Add(ctx, k)
+	switch {
+	case err != nil:
+		// don't lose the event due to the deduplication storage failure
+		d.log.Warn(fmt.Sprintf("pub.dedup: failed to check the key %s: %s", k, err))
+		err = d.svc.Publish(ctx, evt, groupId, userId)
+	case added:
+		d.passed.Add(1)
+		err = d.svc.Publish(ctx, evt, groupId, userId)
+		if err != nil {
+			// allow to publish it again later
+			err = errors.Join(err, d.stor.Delete(ctx, k))
+		}
+	default:
+		suppressed := d.suppressed.Add(1)
+		d.log.Debug(fmt.Sprintf("pub.dedup: suppressed duplicate %s, key=%s, suppressed/passed total: %d/%d", evt.Id, k, suppressed, d.passed.Load()))
+	}
+	d.report()
+	return
+}
+
+func (d dedupService) PublishBatch(ctx context.Context, evts []*pb.CloudEvent, groupId, userId string) (acks []bool, err error) {
+	acks = make([]bool, len(evts))
+	var evtsNew []*pb.CloudEvent
+	var idxsNew []int
+	var keysNew []string
+	for i, evt := range evts {
+		k := dedupKey(evt)
+		added, errAdd := d.stor.Add(ctx, k)
+		switch {
+		case errAdd != nil:
+			d.log.Warn(fmt.Sprintf("pub.dedup: failed to check the key %s: %s", k, errAdd))
+			evtsNew = append(evtsNew, evt)
+			idxsNew = append(idxsNew, i)
+			keysNew = append(keysNew, "")
+		case added:
+			d.passed.Add(1)
+			evtsNew = append(evtsNew, evt)
+			idxsNew = append(idxsNew, i)
+			keysNew = append(keysNew, k)
+		default:
+			acks[i] = true
+			suppressed := d.suppressed.Add(1)
+			d.log.Debug(fmt.Sprintf("pub.dedup: suppressed duplicate %s, key=%s, suppressed/passed total: %d/%d", evt.Id, k, suppressed, d.passed.Load()))
+		}
+	}
+	if len(evtsNew) > 0 {
+		var acksNew []bool
+		acksNew, err = d.svc.PublishBatch(ctx, evtsNew, groupId, userId)
+		for j, i := range idxsNew {
+			acks[i] = j < len(acksNew) && acksNew[j]
+			if !acks[i] && keysNew[j] != "" {
+				err = errors.Join(err, d.stor.Delete(ctx, keysNew[j]))
+			}
+		}
+	}
+	d.report()
+	return
+}
+
+// report logs the totals when the interval elapsed since the previous report.
+func (d dedupService) report() {
+	now := time.Now().UnixNano()
+	prev := d.reported.Load()
+	if now-prev >= d.interval.Nanoseconds() && d.reported.CompareAndSwap(prev, now) {
+		d.log.Info(fmt.Sprintf("pub.dedup: suppressed/passed total: %d/%d", d.suppressed.Load(), d.passed.Load()))
+	}
+}
+
+// dedupKey returns the canonical status URI extended with the event type and the revision if any.
+// Falls back to the event id when the status URI is missing.
+func dedupKey(evt *pb.CloudEvent) (k string) {
+	attrs := evt.GetAttributes()
+	k = attrs[model.CeKeyObject].GetCeUri()
+	if k == "" {
+		k = evt.Id
+	}
+	k = evt.Type + ":" + k
+	if attrRev, present := attrs[model.CeKeyRevision]; present {
+		k += "#" + attrRev.GetCeTimestamp().AsTime().UTC().Format(time.RFC3339Nano)
+	}
+	return
+}
@@ -0,0 +1,143 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"github.com/awakari/int-mastodon/dedup"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type counter struct {
+	svc   Service
+	count int
+}
+
+func (c *counter) Publish(ctx context.Context, evt *pb.CloudEvent, groupId, userId string) (err error) {
+	c.count++
+	return c.svc.Publish(ctx, evt, groupId, userId)
+}
+
+func (c *counter) PublishBatch(ctx context.Context, evts []*pb.CloudEvent, groupId, userId string) (acks []bool, err error) {
+	c.count += len(evts)
+	return c.svc.PublishBatch(ctx, evts, groupId, userId)
+}
+
+func newStatusEvent(id, typ, uri string, rev *time.Time) (evt *pb.CloudEvent) {
+	evt = &pb.CloudEvent{
+		Id:   id,
+		Type: typ,
+		Attributes: map[string]*pb.CloudEventAttributeValue{
+			model.CeKeyObject: {
+				Attr: &pb.CloudEventAttributeValue_CeUri{
+					CeUri: uri,
+				},
+			},
+		},
+	}
+	if rev != nil {
+		evt.Attributes[model.CeKeyRevision] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeTimestamp{
+				CeTimestamp: timestamppb.New(*rev),
+			},
+		}
+	}
+	return
+}
+
+func TestDedupService_Publish(t *testing.T) {
+	rev := time.Date(2024, 12, 20, 10, 40, 15, 0, time.UTC)
+	cases := []struct {
+		evt       *pb.CloudEvent
+		userId    string
+		published bool
+		err       error
+	}{
+		{
+			evt:       newStatusEvent("id1", "type1", "uri1", nil),
+			published: true,
+		},
+		{
+			// same status from another host
+			evt: newStatusEvent("id2", "type1", "uri1", nil),
+		},
+		{
+			evt:       newStatusEvent("id1", "type1", "uri1", &rev),
+			published: true,
+		},
+		{
+			evt:       newStatusEvent("id1", "type1_delete", "uri1", nil),
+			published: true,
+		},
+		{
+			evt:       newStatusEvent("id3", "type1", "uri3", nil),
+			userId:    "noack",
+			published: true,
+			err:       ErrNoAck,
+		},
+		{
+			// retry after the failure
+			evt:       newStatusEvent("id3", "type1", "uri3", nil),
+			published: true,
+		},
+		{
+			evt: newStatusEvent("id3", "type1", "uri3", nil),
+		},
+	}
+	c := &counter{
+		svc: NewMock(),
+	}
+	svc := NewDedup(c, dedup.NewStorageLru(10, time.Minute), time.Minute, slog.Default())
+	for i, tc := range cases {
+		count := c.count
+		err := svc.Publish(context.TODO(), tc.evt, "group1", tc.userId)
+		assert.ErrorIs(t, err, tc.err, "step %d", i)
+		assert.Equal(t, tc.published, c.count > count, "step %d", i)
+	}
+}
+
+func TestDedupService_PublishBatch(t *testing.T) {
+	c := &counter{
+		svc: NewMock(),
+	}
+	svc := NewDedup(c, dedup.NewStorageLru(10, time.Minute), time.Minute, slog.Default())
+	evts := []*pb.CloudEvent{
+		newStatusEvent("id1", "type1", "uri1", nil),
+		newStatusEvent("id2", "type1", "uri2", nil),
+		newStatusEvent("id1", "type1", "uri1", nil),
+	}
+	acks, err := svc.PublishBatch(context.TODO(), evts, "group1", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true}, acks)
+	assert.Equal(t, 2, c.count)
+	evts = []*pb.CloudEvent{
+		newStatusEvent("id2", "type1", "uri2", nil),
+		newStatusEvent("id3", "type1", "uri3", nil),
+	}
+	acks, err = svc.PublishBatch(context.TODO(), evts, "group1", "noack")
+	assert.ErrorIs(t, err, ErrNoAck)
+	assert.Equal(t, []bool{true, false}, acks)
+	assert.Equal(t, 3, c.count)
+	// not acknowledged event is accepted again
+	acks, err = svc.PublishBatch(context.TODO(), evts[1:], "group1", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true}, acks)
+	assert.Equal(t, 4, c.count)
+}
+
+func TestDedupService_Report(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	svc := NewDedup(NewMock(), dedup.NewStorageLru(10, time.Minute), 10*time.Millisecond, log)
+	evt := newStatusEvent("id1", "type1", "uri1", nil)
+	assert.NoError(t, svc.Publish(context.TODO(), evt, "group1", "user1"))
+	assert.Empty(t, buf.String())
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, svc.Publish(context.TODO(), evt, "group1", "user1"))
+	assert.Contains(t, buf.String(), "suppressed/passed total: 1/1")
+}
@@ -28,8 +28,32 @@ type attribute struct {
 }
 
 func MarshalEvent(src *pb.CloudEvent) (data []byte, err error) {
+	var evt event
+	evt, err = convertEvent(src)
+	if err == nil {
+		data, err = sonic.Marshal(evt)
+	}
+	return
+}
 
-	evt := event{
+// MarshalEventBatch encodes the events as a JSON array of the same elements as produced by MarshalEvent.
+func MarshalEventBatch(srcs []*pb.CloudEvent) (data []byte, err error) {
+	evts := make([]event, len(srcs))
+	for i, src := range srcs {
+		evts[i], err = convertEvent(src)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		data, err = sonic.Marshal(evts)
+	}
+	return
+}
+
+func convertEvent(src *pb.CloudEvent) (evt event, err error) {
+
+	evt = event{
 		Id:          src.Id,
 		SpecVersion: src.SpecVersion,
 		Source:      src.Source,
@@ -75,9 +99,5 @@ func MarshalEvent(src *pb.CloudEvent) (data []byte, err error) {
 		}
 	}
 
-	if err == nil {
-		data, err = sonic.Marshal(evt)
-	}
-
 	return
 }
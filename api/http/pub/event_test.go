@@ -2,7 +2,9 @@ package pub
 
 import (
 	"fmt"
+	"github.com/bytedance/sonic"
 	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"testing"
@@ -55,3 +57,42 @@ func TestMarshalEvent(t *testing.T) {
 	require.NoError(t, err)
 	fmt.Println(string(out))
 }
+
+func TestMarshalEventBatch(t *testing.T) {
+	in := []*pb.CloudEvent{
+		{
+			Id:   "id1",
+			Type: "type1",
+			Attributes: map[string]*pb.CloudEventAttributeValue{
+				"string1": {
+					Attr: &pb.CloudEventAttributeValue_CeString{
+						CeString: "string1",
+					},
+				},
+			},
+		},
+		{
+			Id:   "id2",
+			Type: "type1",
+			Data: &pb.CloudEvent_TextData{
+				TextData: "text2",
+			},
+		},
+	}
+	out, err := MarshalEventBatch(in)
+	require.NoError(t, err)
+	var evts []event
+	err = sonic.Unmarshal(out, &evts)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(evts))
+	assert.Equal(t, "string1", *evts[0].Attributes["string1"].CeString)
+	assert.Equal(t, "text2", evts[1].TextData)
+	for i, evtIn := range in {
+		outSingle, err := MarshalEvent(evtIn)
+		require.NoError(t, err)
+		var evt event
+		err = sonic.Unmarshal(outSingle, &evt)
+		require.NoError(t, err)
+		assert.Equal(t, evt, evts[i])
+	}
+}
@@ -22,3 +22,15 @@ func (m mock) Publish(ctx context.Context, evt *pb.CloudEvent, groupId, userId s
 	}
 	return
 }
+
+func (m mock) PublishBatch(ctx context.Context, evts []*pb.CloudEvent, groupId, userId string) (acks []bool, err error) {
+	acks = make([]bool, len(evts))
+	for i, evt := range evts {
+		err = m.Publish(ctx, evt, groupId, userId)
+		if err != nil {
+			break
+		}
+		acks[i] = true
+	}
+	return
+}
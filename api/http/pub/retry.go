@@ -0,0 +1,118 @@
+package pub
+
+import (
+	"context"
+	"errors"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"time"
+)
+
+type retry struct {
+	svc        Service
+	count      uint32
+	backoffMin time.Duration
+	backoffMax time.Duration
+	dl         DeadLetter
+}
+
+// NewRetrying retries the failed publishing with the exponential backoff bounded by the backoffMax unless
+// the failure is permanent. Hands the event to the dead-letter sink when the attempts are exhausted.
+// The batch events stored to the dead-letter sink are acknowledged.
+func NewRetrying(svc Service, count uint32, backoffMin, backoffMax time.Duration, dl DeadLetter) Service {
+	return retry{
+		svc:        svc,
+		count:      count,
+		backoffMin: backoffMin,
+		backoffMax: backoffMax,
+		dl:         dl,
+	}
+}
+
+func (r retry) Publish(ctx context.Context, evt *pb.CloudEvent, groupId, userId string) (err error) {
+	backoff := r.backoffMin
+	for i := uint32(0); ; i++ {
+		err = r.svc.Publish(ctx, evt, groupId, userId)
+		if err == nil || Permanent(err) || i >= r.count {
+			break
+		}
+		err = r.wait(ctx, backoff, err)
+		if ctx.Err() != nil {
+			break
+		}
+		backoff *= 2
+	}
+	if err != nil && ctx.Err() == nil {
+		err = errors.Join(err, r.dl.Put(ctx, evt, groupId, userId, err))
+	}
+	return
+}
+
+func (r retry) PublishBatch(ctx context.Context, evts []*pb.CloudEvent, groupId, userId string) (acks []bool, err error) {
+	acks = make([]bool, len(evts))
+	idxsPending := make([]int, len(evts))
+	for i := range evts {
+		idxsPending[i] = i
+	}
+	backoff := r.backoffMin
+	for i := uint32(0); len(idxsPending) > 0; i++ {
+		evtsPending := make([]*pb.CloudEvent, len(idxsPending))
+		for j, idx := range idxsPending {
+			evtsPending[j] = evts[idx]
+		}
+		var acksPending []bool
+		acksPending, err = r.svc.PublishBatch(ctx, evtsPending, groupId, userId)
+		var idxsFailed []int
+		for j, idx := range idxsPending {
+			if j < len(acksPending) && acksPending[j] {
+				acks[idx] = true
+			} else {
+				idxsFailed = append(idxsFailed, idx)
+			}
+		}
+		idxsPending = idxsFailed
+		if len(idxsPending) > 0 && err == nil {
+			err = ErrNoAck
+		}
+		if len(idxsPending) == 0 || Permanent(err) || i >= r.count {
+			break
+		}
+		err = r.wait(ctx, backoff, err)
+		if ctx.Err() != nil {
+			break
+		}
+		backoff *= 2
+	}
+	if len(idxsPending) > 0 && ctx.Err() == nil {
+		cause := err
+		for _, idx := range idxsPending {
+			errDl := r.dl.Put(ctx, evts[idx], groupId, userId, cause)
+			// acknowledge the dead-lettered event to avoid its redelivery, the cause is still returned
+			acks[idx] = errDl == nil
+			err = errors.Join(err, errDl)
+		}
+	}
+	return
+}
+
+// wait sleeps for the backoff or the delay requested by the writer if longer, bounded by the max backoff.
+func (r retry) wait(ctx context.Context, backoff time.Duration, errPrev error) (err error) {
+	err = errPrev
+	delay := backoff
+	if retryAfter, ok := RetryAfter(errPrev); ok && retryAfter > delay {
+		delay = retryAfter
+	}
+	if delay > r.backoffMax {
+		delay = r.backoffMax
+	}
+	select {
+	case <-ctx.Done():
+		err = errors.Join(err, ctx.Err())
+	case <-time.After(delay):
+	}
+	return
+}
+
+// Permanent returns true when the publishing failure is not going to disappear on the retry.
+func Permanent(err error) bool {
+	return errors.Is(err, ErrInvalid) || errors.Is(err, ErrNoAuth)
+}
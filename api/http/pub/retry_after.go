@@ -0,0 +1,53 @@
+package pub
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type errRetryAfter struct {
+	error
+	delay time.Duration
+}
+
+const keyRetryAfter = "Retry-After"
+
+func (e errRetryAfter) Unwrap() error {
+	return e.error
+}
+
+// RetryAfter returns the delay requested by the writer before the next attempt, if any.
+func RetryAfter(err error) (delay time.Duration, ok bool) {
+	var e errRetryAfter
+	if errors.As(err, &e) {
+		delay, ok = e.delay, true
+	}
+	return
+}
+
+// withRetryAfter attaches the "Retry-After" response header value (either delay seconds or HTTP date) to the error.
+func withRetryAfter(err error, h http.Header) error {
+	v := h.Get(keyRetryAfter)
+	if v == "" {
+		return err
+	}
+	if secs, errConv := strconv.ParseUint(v, 10, 32); errConv == nil {
+		return errRetryAfter{
+			error: err,
+			delay: time.Duration(secs) * time.Second,
+		}
+	}
+	if t, errParse := http.ParseTime(v); errParse == nil {
+		delay := time.Until(t)
+		if delay < 0 {
+			delay = 0
+		}
+		return errRetryAfter{
+			error: err,
+			delay: delay,
+		}
+	}
+	return err
+}
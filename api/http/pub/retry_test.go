@@ -0,0 +1,234 @@
+package pub
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/bytedance/sonic"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry_Publish(t *testing.T) {
+	cases := map[string]struct {
+		statuses   []int
+		retryAfter string
+		attempts   int32
+		deadLetter bool
+		err        error
+	}{
+		"ok": {
+			statuses: []int{http.StatusOK},
+			attempts: 1,
+		},
+		"ok after retries": {
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			retryAfter: "0",
+			attempts:   3,
+		},
+		"invalid is not retried": {
+			statuses:   []int{http.StatusBadRequest, http.StatusOK},
+			attempts:   1,
+			deadLetter: true,
+			err:        ErrInvalid,
+		},
+		"unauthenticated is not retried": {
+			statuses:   []int{http.StatusUnauthorized, http.StatusOK},
+			attempts:   1,
+			deadLetter: true,
+			err:        ErrNoAuth,
+		},
+		"exhausted": {
+			statuses:   []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests},
+			retryAfter: "Wed, 21 Oct 2015 07:28:00 GMT",
+			attempts:   3,
+			deadLetter: true,
+			err:        ErrLimitReached,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := attempts.Add(1) - 1
+				if c.retryAfter != "" {
+					w.Header().Set(keyRetryAfter, c.retryAfter)
+				}
+				w.WriteHeader(c.statuses[i])
+				_, _ = w.Write([]byte(`{"ackCount":1}`))
+			}))
+			defer srv.Close()
+			pathDl := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+			svc := NewService(http.DefaultClient, srv.URL, srv.URL+"/batch", "token1", time.Second)
+			svc = NewRetrying(svc, 2, time.Millisecond, 10*time.Millisecond, NewDeadLetterFile(pathDl))
+			evt := &pb.CloudEvent{
+				Id:   "id1",
+				Type: "type1",
+				Data: &pb.CloudEvent_TextData{
+					TextData: "text1",
+				},
+			}
+			err := svc.Publish(context.TODO(), evt, "group1", "user1")
+			assert.ErrorIs(t, err, c.err)
+			assert.Equal(t, c.attempts, attempts.Load())
+			f, err := os.Open(pathDl)
+			if !c.deadLetter {
+				assert.ErrorIs(t, err, os.ErrNotExist)
+				return
+			}
+			require.NoError(t, err)
+			defer f.Close()
+			scanner := bufio.NewScanner(f)
+			require.True(t, scanner.Scan())
+			var rec DeadLetterRecord
+			err = sonic.Unmarshal(scanner.Bytes(), &rec)
+			require.NoError(t, err)
+			assert.Equal(t, "group1", rec.GroupId)
+			assert.Equal(t, "user1", rec.UserId)
+			assert.NotEmpty(t, rec.Error)
+			var evtRec event
+			err = sonic.Unmarshal(rec.Event, &evtRec)
+			require.NoError(t, err)
+			assert.Equal(t, "id1", evtRec.Id)
+			assert.Equal(t, "text1", evtRec.TextData)
+			assert.False(t, scanner.Scan())
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	cases := map[string]struct {
+		header string
+		delay  time.Duration
+		ok     bool
+	}{
+		"missing": {},
+		"seconds": {
+			header: "120",
+			delay:  2 * time.Minute,
+			ok:     true,
+		},
+		"past date": {
+			header: "Wed, 21 Oct 2015 07:28:00 GMT",
+			ok:     true,
+		},
+		"invalid": {
+			header: "soon",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			h := http.Header{}
+			if c.header != "" {
+				h.Set(keyRetryAfter, c.header)
+			}
+			err := withRetryAfter(ErrNoAck, h)
+			assert.ErrorIs(t, err, ErrNoAck)
+			delay, ok := RetryAfter(err)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.delay, delay)
+		})
+	}
+}
+
+func TestRetry_PublishBatch(t *testing.T) {
+	cases := map[string]struct {
+		ackCounts  []int
+		statuses   []int
+		attempts   int32
+		acks       []bool
+		deadLetter int
+		dlFail     bool
+		err        error
+	}{
+		"ok": {
+			ackCounts: []int{3},
+			statuses:  []int{http.StatusOK},
+			attempts:  1,
+			acks:      []bool{true, true, true},
+		},
+		"partial ack then ok": {
+			ackCounts: []int{1, 0, 2},
+			statuses:  []int{http.StatusOK, http.StatusServiceUnavailable, http.StatusOK},
+			attempts:  3,
+			acks:      []bool{true, true, true},
+		},
+		"partial ack then invalid": {
+			ackCounts:  []int{2, 0},
+			statuses:   []int{http.StatusOK, http.StatusBadRequest},
+			attempts:   2,
+			acks:       []bool{true, true, true},
+			deadLetter: 1,
+			err:        ErrInvalid,
+		},
+		"exhausted": {
+			ackCounts:  []int{0, 0, 0},
+			statuses:   []int{http.StatusOK, http.StatusOK, http.StatusOK},
+			attempts:   3,
+			acks:       []bool{true, true, true},
+			deadLetter: 3,
+			err:        ErrNoAck,
+		},
+		"exhausted, dead letter fails": {
+			ackCounts: []int{1, 0, 0},
+			statuses:  []int{http.StatusOK, http.StatusOK, http.StatusOK},
+			attempts:  3,
+			acks:      []bool{true, false, false},
+			dlFail:    true,
+			err:       ErrNoAck,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var attempts atomic.Int32
+			var batchLens []int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := attempts.Add(1) - 1
+				assert.Equal(t, "/batch", r.URL.Path)
+				var evts []event
+				err := sonic.ConfigDefault.NewDecoder(r.Body).Decode(&evts)
+				require.NoError(t, err)
+				batchLens = append(batchLens, len(evts))
+				w.WriteHeader(c.statuses[i])
+				_, _ = fmt.Fprintf(w, `{"ackCount":%d}`, c.ackCounts[i])
+			}))
+			defer srv.Close()
+			pathDl := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+			if c.dlFail {
+				pathDl = filepath.Join(t.TempDir(), "missing", "dead-letter.jsonl")
+			}
+			svc := NewService(http.DefaultClient, srv.URL, srv.URL+"/batch", "token1", time.Second)
+			svc = NewRetrying(svc, 2, time.Millisecond, 10*time.Millisecond, NewDeadLetterFile(pathDl))
+			evts := []*pb.CloudEvent{
+				{Id: "id1"},
+				{Id: "id2"},
+				{Id: "id3"},
+			}
+			acks, err := svc.PublishBatch(context.TODO(), evts, "group1", "user1")
+			assert.ErrorIs(t, err, c.err)
+			assert.Equal(t, c.acks, acks)
+			assert.Equal(t, c.attempts, attempts.Load())
+			// only the not acknowledged events are sent again
+			for i := 1; i < len(batchLens); i++ {
+				assert.Equal(t, batchLens[i-1]-c.ackCounts[i-1], batchLens[i])
+			}
+			var countDl int
+			if f, errOpen := os.Open(pathDl); errOpen == nil {
+				scanner := bufio.NewScanner(f)
+				for scanner.Scan() {
+					countDl++
+				}
+				_ = f.Close()
+			}
+			assert.Equal(t, c.deadLetter, countDl)
+		})
+	}
+}
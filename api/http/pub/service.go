@@ -15,11 +15,16 @@ import (
 
 type Service interface {
 	Publish(ctx context.Context, evt *pb.CloudEvent, groupId, userId string) (err error)
+
+	// PublishBatch publishes the events on behalf of the same group and user at once.
+	// Returns the acknowledgement flag per event.
+	PublishBatch(ctx context.Context, evts []*pb.CloudEvent, groupId, userId string) (acks []bool, err error)
 }
 
 type service struct {
 	clientHttp *http.Client
 	url        string
+	urlBatch   string
 	token      string
 	timeout    time.Duration
 }
@@ -35,26 +40,59 @@ var ErrNoAuth = errors.New("unauthenticated request")
 var ErrInvalid = errors.New("invalid request")
 var ErrLimitReached = errors.New("publishing limit reached")
 
-func NewService(clientHttp *http.Client, url, token string, timeout time.Duration) Service {
+func NewService(clientHttp *http.Client, url, urlBatch, token string, timeout time.Duration) Service {
 	return service{
 		clientHttp: clientHttp,
 		url:        url,
+		urlBatch:   urlBatch,
 		token:      token,
 		timeout:    timeout,
 	}
 }
 
 func (svc service) Publish(ctx context.Context, evt *pb.CloudEvent, groupId, userId string) (err error) {
-
 	var reqData []byte
 	reqData, err = MarshalEvent(evt)
+	var ackCount uint32
+	if err == nil {
+		ackCount, err = svc.post(ctx, svc.url, reqData, groupId, userId, evt.Id)
+	}
+	if err == nil && ackCount < 1 {
+		err = fmt.Errorf("%w: %s", ErrNoAck, evt.Id)
+	}
+	return
+}
 
-	var req *http.Request
+func (svc service) PublishBatch(ctx context.Context, evts []*pb.CloudEvent, groupId, userId string) (acks []bool, err error) {
+	acks = make([]bool, len(evts))
+	if len(evts) == 0 {
+		return
+	}
+	var reqData []byte
+	reqData, err = MarshalEventBatch(evts)
+	var ackCount uint32
+	if err == nil {
+		ackCount, err = svc.post(ctx, svc.urlBatch, reqData, groupId, userId, fmt.Sprintf("%s...(%d)", evts[0].Id, len(evts)))
+	}
 	if err == nil {
-		ctxTimeout, cancel := context.WithTimeout(ctx, svc.timeout)
-		defer cancel()
-		req, err = http.NewRequestWithContext(ctxTimeout, http.MethodPost, svc.url, bytes.NewReader(reqData))
+		// the writer acknowledges the leading events in the batch order
+		for i := 0; i < len(evts) && uint32(i) < ackCount; i++ {
+			acks[i] = true
+		}
+		if ackCount < uint32(len(evts)) {
+			err = fmt.Errorf("%w: %s", ErrNoAck, evts[ackCount].Id)
+		}
 	}
+	return
+}
+
+func (svc service) post(ctx context.Context, url string, reqData []byte, groupId, userId, ref string) (ackCount uint32, err error) {
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, svc.timeout)
+	defer cancel()
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctxTimeout, http.MethodPost, url, bytes.NewReader(reqData))
 
 	var resp *http.Response
 	if err == nil {
@@ -67,23 +105,23 @@ func (svc service) Publish(ctx context.Context, evt *pb.CloudEvent, groupId, use
 	}
 
 	if err == nil {
+		defer resp.Body.Close()
 		switch resp.StatusCode {
 		case http.StatusServiceUnavailable:
-			err = fmt.Errorf("%w: %s", ErrNoAck, evt.Id)
+			err = withRetryAfter(fmt.Errorf("%w: %s", ErrNoAck, ref), resp.Header)
 		case http.StatusUnauthorized:
 			err = ErrNoAuth
 		case http.StatusRequestTimeout:
-			err = fmt.Errorf("%w: %s", ErrNoAck, evt.Id)
+			err = fmt.Errorf("%w: %s", ErrNoAck, ref)
 		case http.StatusBadRequest:
-			err = fmt.Errorf("%w: %s", ErrInvalid, evt.Id)
+			err = fmt.Errorf("%w: %s", ErrInvalid, ref)
 		case http.StatusTooManyRequests:
-			err = fmt.Errorf("%w: %s", ErrLimitReached, evt.Id)
+			err = withRetryAfter(fmt.Errorf("%w: %s", ErrLimitReached, ref), resp.Header)
 		}
 	}
 
 	var respData []byte
 	if err == nil {
-		defer resp.Body.Close()
 		respData, err = io.ReadAll(resp.Body)
 	}
 
@@ -91,9 +129,8 @@ func (svc service) Publish(ctx context.Context, evt *pb.CloudEvent, groupId, use
 	if err == nil {
 		err = sonic.Unmarshal(respData, &p)
 	}
-
-	if err == nil && p.AckCount < 1 {
-		err = fmt.Errorf("%w: %s", ErrNoAck, evt.Id)
+	if err == nil {
+		ackCount = p.AckCount
 	}
 
 	return
@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrLimited means the rate limit budget is exhausted and resets later than the caller is willing to wait.
+var ErrLimited = errors.New("rate limited")
+
+const keyLimit = "X-RateLimit-Limit"
+const keyRemaining = "X-RateLimit-Remaining"
+const keyReset = "X-RateLimit-Reset"
+const keyRetryAfter = "Retry-After"
+
+// resetDefault is used when the server throttles without telling when to retry, it's the Mastodon rate limit window.
+const resetDefault = 5 * time.Minute
+
+type transport struct {
+	rt      http.RoundTripper
+	reserve int
+	waitMax time.Duration
+	log     *slog.Logger
+	lock    sync.Mutex
+	budgets map[key]*budget
+}
+
+// key is the host and the token, Mastodon limits the requests per account and per IP address.
+type key struct {
+	host  string
+	token string
+}
+
+type budget struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// NewTransport limits the requests per host and token by the Mastodon rate limit response headers:
+// X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset. The reserve is the count of the requests to leave
+// unused. When the budget is exhausted, the request waits for the reset unless it's later than the waitMax, then
+// fails with ErrLimited, so the caller may defer the work. The throttled (HTTP 429) request is retried once after
+// the reset if the request body may be sent again.
+func NewTransport(rt http.RoundTripper, reserve uint32, waitMax time.Duration, log *slog.Logger) http.RoundTripper {
+	return &transport{
+		rt:      rt,
+		reserve: int(reserve),
+		waitMax: waitMax,
+		log:     log,
+		budgets: make(map[key]*budget),
+	}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	k := key{
+		host:  req.URL.Host,
+		token: req.Header.Get("Authorization"),
+	}
+	err = t.wait(req.Context(), k)
+	if err == nil {
+		resp, err = t.rt.RoundTrip(req)
+	}
+	if err == nil {
+		t.update(k, resp)
+		if resp.StatusCode == http.StatusTooManyRequests && (req.Body == nil || req.GetBody != nil) {
+			resp, err = t.retry(req, k, resp)
+		}
+	}
+	return
+}
+
+func (t *transport) retry(req *http.Request, k key, respThrottled *http.Response) (resp *http.Response, err error) {
+	resp = respThrottled
+	if t.wait(req.Context(), k) != nil {
+		// return the throttled response as is
+		return
+	}
+	reqRetry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		reqRetry.Body, err = req.GetBody()
+	}
+	if err == nil {
+		_, _ = io.Copy(io.Discard, respThrottled.Body)
+		_ = respThrottled.Body.Close()
+		resp, err = t.rt.RoundTrip(reqRetry)
+	}
+	if err == nil {
+		t.update(k, resp)
+	}
+	return
+}
+
+func (t *transport) wait(ctx context.Context, k key) (err error) {
+	for {
+		delay := t.acquire(k)
+		if delay <= 0 {
+			break
+		}
+		if delay > t.waitMax {
+			err = fmt.Errorf("%w: %s, resets in %s", ErrLimited, k.host, delay.Round(time.Second))
+			break
+		}
+		t.log.Info(fmt.Sprintf("rate limit %s: waiting %s for the reset", k, delay.Round(time.Millisecond)))
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(delay):
+		}
+		if err != nil {
+			break
+		}
+	}
+	return
+}
+
+// acquire takes one request from the budget and returns the delay until the reset if the budget is exhausted.
+func (t *transport) acquire(k key) (delay time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	b, known := t.budgets[k]
+	if !known {
+		return
+	}
+	now := time.Now()
+	switch {
+	case !now.Before(b.reset):
+		// replenished, the actual budget is known after the response
+		b.remaining = b.limit
+	case b.remaining <= t.reserve:
+		delay = b.reset.Sub(now)
+		return
+	}
+	// taken before the response, so the concurrent requests don't overspend
+	b.remaining--
+	return
+}
+
+func (t *transport) update(k key, resp *http.Response) {
+	now := time.Now()
+	b := budget{
+		limit:     -1,
+		remaining: -1,
+	}
+	b.limit, _ = strconv.Atoi(resp.Header.Get(keyLimit))
+	if v, errConv := strconv.Atoi(resp.Header.Get(keyRemaining)); errConv == nil {
+		b.remaining = v
+	}
+	if v, errParse := time.Parse(time.RFC3339Nano, resp.Header.Get(keyReset)); errParse == nil {
+		b.reset = v
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		b.remaining = 0
+		if b.reset.Before(now) {
+			b.reset = now.Add(retryAfter(resp.Header))
+		}
+	}
+	if b.remaining < 0 || b.reset.IsZero() {
+		// the server doesn't limit
+		return
+	}
+	t.lock.Lock()
+	t.budgets[k] = &b
+	t.lock.Unlock()
+	msg := fmt.Sprintf("rate limit %s: %d of %d remaining, resets at %s", k, b.remaining, b.limit, b.reset.UTC().Format(time.RFC3339))
+	switch {
+	case b.remaining <= t.reserve:
+		t.log.Warn(msg)
+	default:
+		t.log.Debug(msg)
+	}
+}
+
+// retryAfter reads the "Retry-After" header value, either the delay seconds or the HTTP date.
+func retryAfter(h http.Header) (delay time.Duration) {
+	delay = resetDefault
+	v := h.Get(keyRetryAfter)
+	if secs, errConv := strconv.ParseUint(v, 10, 32); errConv == nil {
+		delay = time.Duration(secs) * time.Second
+	} else if at, errParse := http.ParseTime(v); errParse == nil {
+		delay = time.Until(at)
+	}
+	return
+}
+
+// String doesn't reveal the token.
+func (k key) String() string {
+	s := k.host
+	if k.token != "" {
+		h := sha256.Sum256([]byte(k.token))
+		s += "#" + hex.EncodeToString(h[:4])
+	}
+	return s
+}
@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// server limits to the specified count of requests per window and per token
+type server struct {
+	lock      sync.Mutex
+	limit     int
+	window    time.Duration
+	remaining map[string]int
+	reset     map[string]time.Time
+	throttled int
+	served    int
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	tok := r.Header.Get("Authorization")
+	now := time.Now()
+	if reset, ok := s.reset[tok]; !ok || !now.Before(reset) {
+		s.reset[tok] = now.Add(s.window)
+		s.remaining[tok] = s.limit
+	}
+	w.Header().Set(keyLimit, strconv.Itoa(s.limit))
+	w.Header().Set(keyReset, s.reset[tok].UTC().Format(time.RFC3339Nano))
+	if s.remaining[tok] == 0 {
+		w.Header().Set(keyRemaining, "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		s.throttled++
+		return
+	}
+	s.remaining[tok]--
+	s.served++
+	w.Header().Set(keyRemaining, strconv.Itoa(s.remaining[tok]))
+	w.WriteHeader(http.StatusOK)
+}
+
+func newServer(limit int, window time.Duration) *server {
+	return &server{
+		limit:     limit,
+		window:    window,
+		remaining: make(map[string]int),
+		reset:     make(map[string]time.Time),
+	}
+}
+
+func get(t *testing.T, client *http.Client, u, tok string) (status int, err error) {
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, u, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	resp, err := client.Do(req)
+	if err == nil {
+		status = resp.StatusCode
+		_ = resp.Body.Close()
+	}
+	return
+}
+
+func TestTransport_Wait(t *testing.T) {
+	s := newServer(3, 500*time.Millisecond)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	client := &http.Client{
+		Transport: NewTransport(http.DefaultTransport, 1, time.Second, slog.Default()),
+	}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		status, err := get(t, client, srv.URL, "token1")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+	}
+	// the reserved request is left unused, so the 3rd request waits for the reset
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+	assert.Equal(t, 0, s.throttled)
+	// another token has its own budget
+	start = time.Now()
+	status, err := get(t, client, srv.URL, "token2")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestTransport_Limited(t *testing.T) {
+	s := newServer(1, time.Hour)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	client := &http.Client{
+		Transport: NewTransport(http.DefaultTransport, 0, time.Second, slog.Default()),
+	}
+	status, err := get(t, client, srv.URL, "token1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	_, err = get(t, client, srv.URL, "token1")
+	assert.ErrorIs(t, err, ErrLimited)
+	assert.Equal(t, 1, s.served)
+	assert.Equal(t, 0, s.throttled)
+}
+
+func TestTransport_Throttled(t *testing.T) {
+	cases := map[string]struct {
+		header   http.Header
+		retried  bool
+		expected int
+	}{
+		"retry after seconds": {
+			header:   http.Header{keyRetryAfter: []string{"0"}},
+			retried:  true,
+			expected: http.StatusOK,
+		},
+		"reset": {
+			header: http.Header{
+				keyRemaining: []string{"0"},
+				keyReset:     []string{time.Now().Add(100 * time.Millisecond).UTC().Format(time.RFC3339Nano)},
+			},
+			retried:  true,
+			expected: http.StatusOK,
+		},
+		"too long to wait": {
+			header:   http.Header{},
+			expected: http.StatusTooManyRequests,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var count int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				count++
+				if count == 1 {
+					for k, v := range c.header {
+						w.Header()[k] = v
+					}
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				_, _ = w.Write([]byte("ok"))
+			}))
+			defer srv.Close()
+			client := &http.Client{
+				Transport: NewTransport(http.DefaultTransport, 0, time.Second, slog.Default()),
+			}
+			req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("body"))
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, c.expected, resp.StatusCode)
+			assert.Equal(t, c.retried, count == 2)
+		})
+	}
+}
+
+func TestKey_String(t *testing.T) {
+	k := key{
+		host:  "mastodon.social",
+		token: "Bearer secret",
+	}
+	assert.NotContains(t, k.String(), "secret")
+	assert.True(t, strings.HasPrefix(k.String(), "mastodon.social#"))
+}
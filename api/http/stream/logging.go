@@ -0,0 +1,34 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/int-mastodon/util"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"io"
+	"log/slog"
+)
+
+type logging struct {
+	svc Service
+	log *slog.Logger
+}
+
+func NewLogging(svc Service, log *slog.Logger) Service {
+	return logging{
+		svc: svc,
+		log: log,
+	}
+}
+
+func (l logging) Consume(ctx context.Context, host, token, name, lastEvtId string, consume util.ConsumeFunc[[]*pb.CloudEvent]) (lastEvtIdOut string, err error) {
+	lastEvtIdOut, err = l.svc.Consume(ctx, host, token, name, lastEvtId, consume)
+	lvl := util.LogLevel(err)
+	if errors.Is(err, io.EOF) {
+		// the stream is closed by the server normally
+		lvl = slog.LevelInfo
+	}
+	l.log.Log(ctx, lvl, fmt.Sprintf("stream.Consume(host=%s, name=%s, lastEvtId=%s): %s, err=%s", host, name, lastEvtId, lastEvtIdOut, err))
+	return
+}
@@ -0,0 +1,211 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/awakari/int-mastodon/util"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/segmentio/ksuid"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Service interface {
+	// Consume opens the named Mastodon stream (e.g. "public", "public:local", "hashtag:foo", "list:123") on the host
+	// and feeds the received events to the consume function in batches until the connection is closed or fails.
+	// Returns the last received event id to resume from on the next call.
+	Consume(ctx context.Context, host, token, name, lastEvtId string, consume util.ConsumeFunc[[]*pb.CloudEvent]) (lastEvtIdOut string, err error)
+}
+
+type service struct {
+	clientHttp   *http.Client
+	userAgent    string
+	protocol     string
+	endpoint     string
+	batchSize    uint32
+	batchTimeout time.Duration
+}
+
+type event struct {
+	id   string
+	typ  string
+	data []byte
+}
+
+const valContentTypeSse = "text/event-stream"
+const keyLastEventId = "Last-Event-ID"
+const evtTypeDefault = "message"
+const limitRespBodyLenErr = 1_024
+
+var ErrUnexpectedResponse = errors.New("unexpected stream response")
+
+func NewService(clientHttp *http.Client, userAgent, protocol, endpoint string, batchSize uint32, batchTimeout time.Duration) Service {
+	return service{
+		clientHttp:   clientHttp,
+		userAgent:    userAgent,
+		protocol:     protocol,
+		endpoint:     endpoint,
+		batchSize:    batchSize,
+		batchTimeout: batchTimeout,
+	}
+}
+
+func (svc service) Consume(ctx context.Context, host, token, name, lastEvtId string, consume util.ConsumeFunc[[]*pb.CloudEvent]) (lastEvtIdOut string, err error) {
+
+	lastEvtIdOut = lastEvtId
+	src := svc.protocol + host + svc.endpoint + streamPath(name)
+
+	ctxStream, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctxStream, http.MethodGet, src, nil)
+	var resp *http.Response
+	if err == nil {
+		req.Header.Add("Accept", valContentTypeSse)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Cache-Control", "no-cache")
+		req.Header.Add("User-Agent", svc.userAgent)
+		if lastEvtId != "" {
+			req.Header.Add(keyLastEventId, lastEvtId)
+		}
+		resp, err = svc.clientHttp.Do(req)
+	}
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			data, _ := io.ReadAll(io.LimitReader(resp.Body, limitRespBodyLenErr))
+			err = fmt.Errorf("%w: url=%s, response=%d/%s", ErrUnexpectedResponse, src, resp.StatusCode, string(data))
+		}
+	}
+
+	if err == nil {
+		evts := make(chan event)
+		errRead := make(chan error, 1)
+		go func() {
+			errRead <- readEvents(ctxStream, resp.Body, evts)
+			close(evts)
+		}()
+		var batch []*pb.CloudEvent
+		timer := time.NewTimer(svc.batchTimeout)
+		defer timer.Stop()
+		for err == nil {
+			select {
+			case evt, ok := <-evts:
+				if !ok {
+					err = <-errRead
+					if len(batch) > 0 {
+						err = errors.Join(err, consume(batch))
+					}
+					if err == nil {
+						err = io.EOF
+					}
+					break
+				}
+				if evt.id != "" {
+					lastEvtIdOut = evt.id
+				}
+				batch = append(batch, convertEvent(evt, src))
+				if uint32(len(batch)) >= svc.batchSize {
+					err = consume(batch)
+					batch = nil
+				}
+			case <-timer.C:
+				if len(batch) > 0 {
+					err = consume(batch)
+					batch = nil
+				}
+				timer.Reset(svc.batchTimeout)
+			}
+		}
+	}
+
+	return
+}
+
+// streamPath maps the stream name to the Mastodon streaming API path, e.g.:
+// "public:local" -> "/public/local", "hashtag:foo" -> "/hashtag?tag=foo", "list:123" -> "/list?list=123"
+func streamPath(name string) (p string) {
+	parts := strings.Split(name, ":")
+	switch parts[0] {
+	case "hashtag":
+		if len(parts) > 2 && parts[1] == "local" {
+			p = "/hashtag/local?tag=" + url.QueryEscape(parts[2])
+		} else if len(parts) > 1 {
+			p = "/hashtag?tag=" + url.QueryEscape(parts[1])
+		}
+	case "list":
+		if len(parts) > 1 {
+			p = "/list?list=" + url.QueryEscape(parts[1])
+		}
+	default:
+		p = "/" + strings.Join(parts, "/")
+	}
+	return
+}
+
+// readEvents parses the server-sent events frames until the reader is exhausted or the context is done.
+func readEvents(ctx context.Context, r io.Reader, evts chan<- event) (err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+	var evt event
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// blank line dispatches the event
+			if len(data) > 0 {
+				if evt.typ == "" {
+					evt.typ = evtTypeDefault
+				}
+				evt.data = []byte(strings.Join(data, "\n"))
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case evts <- evt:
+				}
+			}
+			evt = event{}
+			data = nil
+		case strings.HasPrefix(line, ":"):
+			// comment, e.g. the ":thump" heartbeat
+		default:
+			k, v, _ := strings.Cut(line, ":")
+			v = strings.TrimPrefix(v, " ")
+			switch k {
+			case "event":
+				evt.typ = v
+			case "data":
+				data = append(data, v)
+			case "id":
+				evt.id = v
+			}
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+func convertEvent(evt event, src string) (dst *pb.CloudEvent) {
+	id := evt.id
+	if id == "" {
+		id = ksuid.New().String()
+	}
+	dst = &pb.CloudEvent{
+		Id:          id,
+		Source:      src,
+		SpecVersion: model.CeSpecVersion,
+		Type:        evt.typ,
+		Data: &pb.CloudEvent_BinaryData{
+			BinaryData: evt.data,
+		},
+	}
+	return
+}
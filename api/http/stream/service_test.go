@@ -0,0 +1,193 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_Consume(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") != "Bearer token1":
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"The access token is invalid"}`))
+		case r.URL.Path != "/api/v1/streaming/public":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Header().Set("Content-Type", valContentTypeSse)
+			w.WriteHeader(http.StatusOK)
+			switch r.Header.Get(keyLastEventId) {
+			case "":
+				_, _ = fmt.Fprint(w, ":)\n\n")
+				_, _ = fmt.Fprint(w, "event: update\nid: 1\ndata: {\"uri\":\"https://host1/statuses/1\"}\n\n")
+				_, _ = fmt.Fprint(w, ":thump\n")
+				_, _ = fmt.Fprint(w, "event: delete\ndata: 2\n\n")
+				_, _ = fmt.Fprint(w, "event: update\nid: 3\ndata: {\"uri\":\n")
+				_, _ = fmt.Fprint(w, "data: \"https://host1/statuses/3\"}\n\n")
+			default:
+				_, _ = fmt.Fprint(w, "event: update\nid: 4\ndata: {}\n\n")
+			}
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	cases := map[string]struct {
+		token     string
+		name      string
+		lastEvtId string
+		consumed  []*pb.CloudEvent
+		lastOut   string
+		errFail   bool
+		err       error
+	}{
+		"ok": {
+			token: "token1",
+			name:  "public",
+			consumed: []*pb.CloudEvent{
+				{
+					Id:   "1",
+					Type: "update",
+					Data: &pb.CloudEvent_BinaryData{
+						BinaryData: []byte(`{"uri":"https://host1/statuses/1"}`),
+					},
+				},
+				{
+					Type: "delete",
+					Data: &pb.CloudEvent_BinaryData{
+						BinaryData: []byte("2"),
+					},
+				},
+				{
+					Id:   "3",
+					Type: "update",
+					Data: &pb.CloudEvent_BinaryData{
+						BinaryData: []byte("{\"uri\":\n\"https://host1/statuses/3\"}"),
+					},
+				},
+			},
+			lastOut: "3",
+			err:     io.EOF,
+		},
+		"resume": {
+			token:     "token1",
+			name:      "public",
+			lastEvtId: "3",
+			consumed: []*pb.CloudEvent{
+				{
+					Id:   "4",
+					Type: "update",
+					Data: &pb.CloudEvent_BinaryData{
+						BinaryData: []byte("{}"),
+					},
+				},
+			},
+			lastOut: "4",
+			err:     io.EOF,
+		},
+		"consume fails": {
+			token:   "token1",
+			name:    "public",
+			errFail: true,
+			lastOut: "3",
+			err:     errFailConsume,
+		},
+		"unauthorized": {
+			token: "token2",
+			name:  "public",
+			err:   ErrUnexpectedResponse,
+		},
+		"not found": {
+			token: "token1",
+			name:  "list:123",
+			err:   ErrUnexpectedResponse,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			svc := NewService(http.DefaultClient, "test", "http://", "/api/v1/streaming", 100, 100*time.Millisecond)
+			var consumed []*pb.CloudEvent
+			consume := func(evts []*pb.CloudEvent) (err error) {
+				if c.errFail {
+					err = errFailConsume
+				}
+				consumed = append(consumed, evts...)
+				return
+			}
+			lastOut, err := svc.Consume(context.TODO(), host, c.token, c.name, c.lastEvtId, consume)
+			assert.ErrorIs(t, err, c.err)
+			assert.Equal(t, c.lastOut, lastOut)
+			if !c.errFail {
+				require.Equal(t, len(c.consumed), len(consumed))
+				for i, evt := range consumed {
+					if c.consumed[i].Id != "" {
+						assert.Equal(t, c.consumed[i].Id, evt.Id)
+					} else {
+						assert.NotEmpty(t, evt.Id)
+					}
+					assert.Equal(t, c.consumed[i].Type, evt.Type)
+					assert.Equal(t, c.consumed[i].GetBinaryData(), evt.GetBinaryData())
+					assert.Equal(t, srv.URL+"/api/v1/streaming/public", evt.Source)
+				}
+			}
+		})
+	}
+}
+
+func TestService_Consume_Batches(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", valContentTypeSse)
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 5; i++ {
+			_, _ = fmt.Fprintf(w, "event: update\ndata: %d\n\n", i)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	svc := NewService(http.DefaultClient, "test", "http://", "/api/v1/streaming", 2, 10*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.TODO(), 1*time.Second)
+	defer cancel()
+	var batchSizes []int
+	var count int
+	consume := func(evts []*pb.CloudEvent) (err error) {
+		batchSizes = append(batchSizes, len(evts))
+		count += len(evts)
+		if count == 5 {
+			cancel()
+		}
+		return
+	}
+	_, err := svc.Consume(ctx, host, "token1", "hashtag:foo", "", consume)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []int{2, 2, 1}, batchSizes)
+}
+
+func TestStreamPath(t *testing.T) {
+	cases := map[string]string{
+		"public":            "/public",
+		"public:local":      "/public/local",
+		"public:remote":     "/public/remote",
+		"user":              "/user",
+		"hashtag:foo":       "/hashtag?tag=foo",
+		"hashtag:local:bar": "/hashtag/local?tag=bar",
+		"list:123":          "/list?list=123",
+	}
+	for name, expected := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, expected, streamPath(name))
+		})
+	}
+}
+
+var errFailConsume = errors.New("consume failure")
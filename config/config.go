@@ -9,12 +9,28 @@ type Config struct {
 	Api struct {
 		Port   uint16 `envconfig:"API_PORT" default:"50051" required:"true"`
 		Writer struct {
-			Backoff time.Duration `envconfig:"API_WRITER_BACKOFF" default:"10s" required:"true"`
-			Timeout time.Duration `envconfig:"API_WRITER_TIMEOUT" default:"10s" required:"true"`
-			Uri     string        `envconfig:"API_WRITER_URI" default:"http://pub:8080/v1" required:"true"`
+			Backoff  time.Duration `envconfig:"API_WRITER_BACKOFF" default:"10s" required:"true"`
+			Timeout  time.Duration `envconfig:"API_WRITER_TIMEOUT" default:"10s" required:"true"`
+			Uri      string        `envconfig:"API_WRITER_URI" default:"http://pub:8080/v1" required:"true"`
+			UriBatch string        `envconfig:"API_WRITER_URI_BATCH" default:"http://pub:8080/v1/batch" required:"true"`
+			Retry    struct {
+				Count      uint32        `envconfig:"API_WRITER_RETRY_COUNT" default:"5" required:"true"`
+				BackoffMin time.Duration `envconfig:"API_WRITER_RETRY_BACKOFF_MIN" default:"100ms" required:"true"`
+			}
+			DeadLetter struct {
+				Path string `envconfig:"API_WRITER_DEAD_LETTER_PATH" default:""`
+			}
+			// Dedup is the in-process LRU of the recently published statuses, so it doesn't deduplicate across the replicas
+			Dedup struct {
+				Size uint32        `envconfig:"API_WRITER_DEDUP_SIZE" default:"10000" required:"true"`
+				Ttl  time.Duration `envconfig:"API_WRITER_DEDUP_TTL" default:"1h" required:"true"`
+				// ReportInterval is the minimum interval to log the suppressed/passed totals at
+				ReportInterval time.Duration `envconfig:"API_WRITER_DEDUP_REPORT_INTERVAL" default:"1m" required:"true"`
+			}
 		}
 		Event struct {
-			Type string `envconfig:"API_EVENT_TYPE" required:"true" default:"com_awakari_mastodon_v1"`
+			Type       string `envconfig:"API_EVENT_TYPE" required:"true" default:"com_awakari_mastodon_v1"`
+			TypeDelete string `envconfig:"API_EVENT_TYPE_DELETE" required:"true" default:"com_awakari_mastodon_delete_v1"`
 		}
 		ActivityPub struct {
 			Host string `envconfig:"API_ACTIVITYPUB_HOST" default:"activitypub.awakari.com" required:"true"`
@@ -29,6 +45,18 @@ type Config struct {
 	Log struct {
 		Level int `envconfig:"LOG_LEVEL" default:"-4" required:"true"`
 	}
+	Storage struct {
+		// Path of the file to keep the discovered sources, in-memory only when empty.
+		// Either way the sources are per replica, the interest removal doesn't rely on them.
+		Path string `envconfig:"STORAGE_PATH" default:""`
+		// TtlRejected is the time to keep the rejected and failed sources, forever when zero.
+		TtlRejected time.Duration `envconfig:"STORAGE_TTL_REJECTED" default:"168h"`
+	}
+	Shutdown struct {
+		Timeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"25s" required:"true"`
+		// DrainDelay is the time between reporting NOT_SERVING health status and stopping the gRPC server
+		DrainDelay time.Duration `envconfig:"SHUTDOWN_DRAIN_DELAY" default:"5s" required:"true"`
+	}
 }
 
 type MastodonConfig struct {
@@ -36,24 +64,112 @@ type MastodonConfig struct {
 		Tokens    []string `envconfig:"API_MASTODON_CLIENT_TOKENS" required:"true"`
 		Hosts     []string `envconfig:"API_MASTODON_CLIENT_HOSTS" required:"true" default:"mastodon.social"`
 		UserAgent string   `envconfig:"API_MASTODON_CLIENT_USER_AGENT" default:"awakari" required:"true"`
+		RateLimit struct {
+			// Reserve is the count of the requests per rate limit window to leave for the other token users
+			Reserve uint32 `envconfig:"API_MASTODON_CLIENT_RATE_LIMIT_RESERVE" default:"10" required:"true"`
+			// WaitMax is the longest wait for the rate limit reset, the request fails when the reset is later
+			WaitMax time.Duration `envconfig:"API_MASTODON_CLIENT_RATE_LIMIT_WAIT_MAX" default:"1m" required:"true"`
+		}
+	}
+	Content struct {
+		// Html enables the sanitized copy of the status HTML in the separate event attribute
+		Html    bool `envconfig:"API_MASTODON_CONTENT_HTML" default:"false" required:"true"`
+		Warning struct {
+			// Publish the sensitive statuses having the content warning, the warning becomes the event subject
+			Publish bool `envconfig:"API_MASTODON_CONTENT_WARNING_PUBLISH" default:"false" required:"true"`
+		}
 	}
 	CountMin struct {
 		Followers uint32 `envconfig:"API_MASTODON_COUNT_MIN_FOLLOWERS" default:"100" required:"true"`
 		Posts     uint32 `envconfig:"API_MASTODON_COUNT_MIN_POSTS" default:"1000" required:"true"`
 	}
 	Endpoint struct {
-		Protocol string `envconfig:"API_MASTODON_ENDPOINT_PROTOCOL" default:"https://" required:"true"`
-		Accounts string `envconfig:"API_MASTODON_ENDPOINT_ACCOUNTS" default:"/api/v1/accounts" required:"true"`
-		Search   string `envconfig:"API_MASTODON_ENDPOINT_SEARCH" default:"/api/v2/search" required:"true"`
+		Protocol  string `envconfig:"API_MASTODON_ENDPOINT_PROTOCOL" default:"https://" required:"true"`
+		Accounts  string `envconfig:"API_MASTODON_ENDPOINT_ACCOUNTS" default:"/api/v1/accounts" required:"true"`
+		Search    string `envconfig:"API_MASTODON_ENDPOINT_SEARCH" default:"/api/v2/search" required:"true"`
+		Streaming string `envconfig:"API_MASTODON_ENDPOINT_STREAMING" default:"/api/v1/streaming" required:"true"`
+		Tags      string `envconfig:"API_MASTODON_ENDPOINT_TAGS" default:"/api/v1/timelines/tag" required:"true"`
+	}
+	Instance InstanceConfig
+	Policy   struct {
+		// Rules to apply in the specified order, see the policy package for the supported names.
+		// The "reply" and "quote" rules are off by default: the replies and quotes are published along with the
+		// threading attributes for the subscribers to reconstruct the context.
+		Rules      []string `envconfig:"API_MASTODON_POLICY_RULES" default:"sensitive,visibility,discoverable,indexable,noindex,optout,followers,posts" required:"true"`
+		Visibility []string `envconfig:"API_MASTODON_POLICY_VISIBILITY" default:"public" required:"true"`
+		// OptOut markers, either hashtags (starting with "#") or phrases/emojis to find in the account bio and profile fields
+		OptOut []string `envconfig:"API_MASTODON_POLICY_OPT_OUT" default:"#nobot,#nobots,#nosearch,#noindex,#noarchive,#noai,🚫🤖" required:"true"`
+		// Reblog is what to do with the boost: "publish" the boosted status with the "boostedby" attribute,
+		// "follow" the boosted status author or "skip"
+		Reblog string `envconfig:"API_MASTODON_POLICY_REBLOG" default:"publish" required:"true"`
 	}
 	Search struct {
 		Limit uint32 `envconfig:"API_MASTODON_SEARCH_LIMIT" default:"10" required:"true"`
+		// Concurrency is the count of the hosts to search at once
+		Concurrency uint32        `envconfig:"API_MASTODON_SEARCH_CONCURRENCY" default:"4" required:"true"`
+		Timeout     time.Duration `envconfig:"API_MASTODON_SEARCH_TIMEOUT" default:"10s" required:"true"`
+		// PagesMax is the count of the result pages to fetch at most per host, in case the server ignores the limit
+		PagesMax uint32 `envconfig:"API_MASTODON_SEARCH_PAGES_MAX" default:"10" required:"true"`
+	}
+	Stream struct {
+		// Enabled is off by default because every replica consumes the same streams and publishes the same statuses
+		Enabled   bool     `envconfig:"API_MASTODON_STREAM_ENABLED" default:"false" required:"true"`
+		Names     []string `envconfig:"API_MASTODON_STREAM_NAMES" default:"public" required:"true"`
+		IndexSize uint32   `envconfig:"API_MASTODON_STREAM_INDEX_SIZE" default:"10000" required:"true"`
+		Backoff   struct {
+			Min time.Duration `envconfig:"API_MASTODON_STREAM_BACKOFF_MIN" default:"1s" required:"true"`
+			Max time.Duration `envconfig:"API_MASTODON_STREAM_BACKOFF_MAX" default:"5m" required:"true"`
+		}
+		Batch struct {
+			Size    uint32        `envconfig:"API_MASTODON_STREAM_BATCH_SIZE" default:"100" required:"true"`
+			Timeout time.Duration `envconfig:"API_MASTODON_STREAM_BATCH_TIMEOUT" default:"1s" required:"true"`
+		}
+	}
+	// Tags polls the hashtag timelines for the hashtags found in the interests' queries.
+	// Requires the persistent storage path and a single replica, because the followed hashtags and the timeline
+	// cursors are kept in the storage of the replica.
+	Tags struct {
+		Enabled  bool          `envconfig:"API_MASTODON_TAGS_ENABLED" default:"false" required:"true"`
+		Interval time.Duration `envconfig:"API_MASTODON_TAGS_INTERVAL" default:"1m" required:"true"`
+		// Limit is the count of the statuses per page, Mastodon doesn't return more than 40
+		Limit uint32 `envconfig:"API_MASTODON_TAGS_LIMIT" default:"40" required:"true"`
+		// PagesMax is the count of the pages to fetch at most per hashtag and host in a single poll
+		PagesMax uint32        `envconfig:"API_MASTODON_TAGS_PAGES_MAX" default:"5" required:"true"`
+		Timeout  time.Duration `envconfig:"API_MASTODON_TAGS_TIMEOUT" default:"10s" required:"true"`
+	}
+}
+
+type InstanceConfig struct {
+	// Block lists the blocked domains, the subdomains are blocked too
+	Block []string `envconfig:"API_MASTODON_INSTANCE_BLOCK" default:""`
+	// BlockCsv is the path of the domain block list file in the Mastodon export format
+	BlockCsv string `envconfig:"API_MASTODON_INSTANCE_BLOCK_CSV" default:""`
+	// Allow lists the only allowed domains with their subdomains, any domain is allowed when empty
+	Allow  []string `envconfig:"API_MASTODON_INSTANCE_ALLOW" default:""`
+	Robots struct {
+		Enabled bool `envconfig:"API_MASTODON_INSTANCE_ROBOTS_ENABLED" default:"false" required:"true"`
+	}
+	NodeInfo struct {
+		Enabled bool `envconfig:"API_MASTODON_INSTANCE_NODEINFO_ENABLED" default:"false" required:"true"`
+		// Software names to block, e.g. "gotosocial"
+		Software []string `envconfig:"API_MASTODON_INSTANCE_NODEINFO_SOFTWARE" default:""`
+		// Metadata keys, any of them having the true value opts the instance out
+		OptOut []string `envconfig:"API_MASTODON_INSTANCE_NODEINFO_OPT_OUT" default:"noindex,noIndex,nosearch,noSearch"`
 	}
+	Cache struct {
+		Size uint32        `envconfig:"API_MASTODON_INSTANCE_CACHE_SIZE" default:"10000" required:"true"`
+		Ttl  time.Duration `envconfig:"API_MASTODON_INSTANCE_CACHE_TTL" default:"24h" required:"true"`
+		// TtlFailure is used instead of Ttl when the instance metadata fetch failed
+		TtlFailure time.Duration `envconfig:"API_MASTODON_INSTANCE_CACHE_TTL_FAILURE" default:"5m" required:"true"`
+	}
+	Timeout time.Duration `envconfig:"API_MASTODON_INSTANCE_TIMEOUT" default:"10s" required:"true"`
 }
 
 type QueueConfig struct {
-	BackoffError     time.Duration `envconfig:"API_QUEUE_BACKOFF_ERROR" default:"1s" required:"true"`
-	Uri              string        `envconfig:"API_QUEUE_URI" default:"queue:50051" required:"true"`
+	BackoffError time.Duration `envconfig:"API_QUEUE_BACKOFF_ERROR" default:"1s" required:"true"`
+	Uri          string        `envconfig:"API_QUEUE_URI" default:"queue:50051" required:"true"`
+	// AttemptsMax is the count of the attempts to consume the interest event, it's skipped after
+	AttemptsMax      uint32 `envconfig:"API_QUEUE_ATTEMPTS_MAX" default:"10" required:"true"`
 	InterestsCreated struct {
 		BatchSize uint32 `envconfig:"API_QUEUE_INTERESTS_CREATED_BATCH_SIZE" default:"1" required:"true"`
 		Name      string `envconfig:"API_QUEUE_INTERESTS_CREATED_NAME" default:"int-mastodon" required:"true"`
@@ -64,7 +180,14 @@ type QueueConfig struct {
 		Name      string `envconfig:"API_QUEUE_INTERESTS_UPDATED_NAME" default:"int-mastodon" required:"true"`
 		Subj      string `envconfig:"API_QUEUE_INTERESTS_UPDATED_SUBJ" default:"interests-updated" required:"true"`
 	}
+	InterestsDeleted struct {
+		BatchSize uint32 `envconfig:"API_QUEUE_INTERESTS_DELETED_BATCH_SIZE" default:"1" required:"true"`
+		Name      string `envconfig:"API_QUEUE_INTERESTS_DELETED_NAME" default:"int-mastodon" required:"true"`
+		Subj      string `envconfig:"API_QUEUE_INTERESTS_DELETED_SUBJ" default:"interests-deleted" required:"true"`
+	}
 	SourceSse struct {
+		// Enabled by default, the live statuses are ingested from the source-sse queue unless the native stream is used
+		Enabled   bool   `envconfig:"API_QUEUE_SRC_SSE_ENABLED" default:"true" required:"true"`
 		BatchSize uint32 `envconfig:"API_QUEUE_SRC_SSE_BATCH_SIZE" default:"100" required:"true"`
 		Name      string `envconfig:"API_QUEUE_SRC_SSE_NAME" default:"int-mastodon" required:"true"`
 		Subj      string `envconfig:"API_QUEUE_SRC_SSE_SUBJ" default:"source-sse-mastodon" required:"true"`
@@ -23,4 +23,7 @@ func TestConfig(t *testing.T) {
 	assert.Equal(t, "writer:56789", cfg.Api.Writer.Uri)
 	assert.Equal(t, slog.LevelWarn, slog.Level(cfg.Log.Level))
 	assert.Equal(t, []string{"token1", "token2"}, cfg.Api.Mastodon.Client.Tokens)
+	assert.Equal(t, []string{"public"}, cfg.Api.Mastodon.Stream.Names)
+	assert.Equal(t, []string{"sensitive", "visibility", "discoverable", "indexable", "noindex", "optout", "followers", "posts"}, cfg.Api.Mastodon.Policy.Rules)
+	assert.Contains(t, cfg.Api.Mastodon.Policy.OptOut, "#nosearch")
 }
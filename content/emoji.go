@@ -0,0 +1,45 @@
+package content
+
+import (
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// reShortcode matches the custom emoji shortcode the way Mastodon does, e.g. ":blobcat:".
+var reShortcode = regexp.MustCompile(`:([a-zA-Z0-9_]{2,}):`)
+
+// EmojiNames replaces the known custom emoji shortcodes in the plain text with their names, e.g. ":blobcat:" becomes
+// "blobcat". The emojis map the shortcodes to the image URLs.
+func EmojiNames(txt string, emojis map[string]string) string {
+	if len(emojis) == 0 || !strings.Contains(txt, ":") {
+		return txt
+	}
+	return reShortcode.ReplaceAllStringFunc(txt, func(m string) string {
+		code := m[1 : len(m)-1]
+		if _, known := emojis[code]; known {
+			return code
+		}
+		return m
+	})
+}
+
+// emojiImages escapes the text replacing the known custom emoji shortcodes with the images.
+func emojiImages(txt string, emojis map[string]string) string {
+	var sb strings.Builder
+	var last int
+	if len(emojis) > 0 {
+		for _, idx := range reShortcode.FindAllStringSubmatchIndex(txt, -1) {
+			code := txt[idx[2]:idx[3]]
+			u, known := emojis[code]
+			if !known || !isWebUrl(u) {
+				continue
+			}
+			sb.WriteString(html.EscapeString(txt[last:idx[0]]))
+			sb.WriteString(`<img src="` + html.EscapeString(u) + `" alt=":` + code + `:" class="custom-emoji">`)
+			last = idx[1]
+		}
+	}
+	sb.WriteString(html.EscapeString(txt[last:]))
+	return sb.String()
+}
@@ -0,0 +1,36 @@
+package content
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEmojiNames(t *testing.T) {
+	emojis := map[string]string{
+		"blobcat":  "https://host/emoji/blobcat.png",
+		"ablobfox": "https://host/emoji/ablobfox.png",
+	}
+	cases := map[string]struct {
+		txt      string
+		expected string
+	}{
+		"empty": {},
+		"known": {
+			txt:      "I love :blobcat: and :ablobfox:!",
+			expected: "I love blobcat and ablobfox!",
+		},
+		"unknown": {
+			txt:      "time 10:30:00 :foo:",
+			expected: "time 10:30:00 :foo:",
+		},
+		"adjacent": {
+			txt:      ":blobcat::ablobfox:",
+			expected: "blobcatablobfox",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.expected, EmojiNames(c.txt, emojis))
+		})
+	}
+}
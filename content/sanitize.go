@@ -0,0 +1,128 @@
+package content
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strings"
+)
+
+// allowedTags is the formatting subset Mastodon itself renders. Other block elements become the paragraphs, the rest
+// is unwrapped.
+var allowedTags = map[atom.Atom]bool{
+	atom.A:          true,
+	atom.B:          true,
+	atom.Blockquote: true,
+	atom.Br:         true,
+	atom.Code:       true,
+	atom.Del:        true,
+	atom.Em:         true,
+	atom.I:          true,
+	atom.Li:         true,
+	atom.Ol:         true,
+	atom.P:          true,
+	atom.Pre:        true,
+	atom.S:          true,
+	atom.Span:       true,
+	atom.Strong:     true,
+	atom.U:          true,
+	atom.Ul:         true,
+}
+
+// droppedTags are removed together with their contents.
+var droppedTags = map[atom.Atom]bool{
+	atom.Iframe:   true,
+	atom.Noscript: true,
+	atom.Object:   true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Template: true,
+}
+
+// allowedClasses are the microformats and the link shortening classes used by Mastodon.
+var allowedClasses = map[string]bool{
+	"ellipsis":  true,
+	"h-card":    true,
+	"hashtag":   true,
+	"invisible": true,
+	"mention":   true,
+	"u-url":     true,
+}
+
+const relLink = "nofollow noopener noreferrer"
+
+// Sanitize returns the safe HTML keeping the allowed formatting elements only. The links keep the web URLs only and
+// get the rel="nofollow noopener noreferrer" attribute, any other attribute except the known classes is removed.
+// The known custom emoji shortcodes become the images, the emojis map the shortcodes to the image URLs.
+func Sanitize(src string, emojis map[string]string) string {
+	nodes, err := parse(src)
+	if err != nil {
+		return html.EscapeString(src)
+	}
+	var sb strings.Builder
+	for _, n := range nodes {
+		sanitizeNode(&sb, n, emojis)
+	}
+	return sb.String()
+}
+
+func sanitizeNode(sb *strings.Builder, n *html.Node, emojis map[string]string) {
+	switch n.Type {
+	case html.TextNode:
+		sb.WriteString(emojiImages(n.Data, emojis))
+	case html.ElementNode:
+		switch {
+		case droppedTags[n.DataAtom]:
+		case n.DataAtom == atom.Img:
+			// custom emoji
+			sb.WriteString(html.EscapeString(attr(n, "alt")))
+		case allowedTags[n.DataAtom]:
+			sb.WriteString("<" + n.Data)
+			writeAttrs(sb, n)
+			sb.WriteString(">")
+			if n.DataAtom == atom.Br {
+				return
+			}
+			sanitizeChildren(sb, n, emojis)
+			sb.WriteString("</" + n.Data + ">")
+		case isBlock(n.DataAtom):
+			// e.g. the headings
+			sb.WriteString("<p>")
+			sanitizeChildren(sb, n, emojis)
+			sb.WriteString("</p>")
+		default:
+			sanitizeChildren(sb, n, emojis)
+		}
+	default:
+		sanitizeChildren(sb, n, emojis)
+	}
+}
+
+func sanitizeChildren(sb *strings.Builder, n *html.Node, emojis map[string]string) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sanitizeNode(sb, c, emojis)
+	}
+}
+
+func writeAttrs(sb *strings.Builder, n *html.Node) {
+	var classes []string
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if allowedClasses[c] {
+			classes = append(classes, c)
+		}
+	}
+	if n.DataAtom == atom.A {
+		if href := attr(n, "href"); isWebUrl(href) {
+			writeAttr(sb, "href", href)
+		}
+	}
+	if len(classes) > 0 {
+		writeAttr(sb, "class", strings.Join(classes, " "))
+	}
+	if n.DataAtom == atom.A {
+		writeAttr(sb, "rel", relLink)
+	}
+}
+
+func writeAttr(sb *strings.Builder, k, v string) {
+	sb.WriteString(" " + k + "=\"" + html.EscapeString(v) + "\"")
+}
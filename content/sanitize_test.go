@@ -0,0 +1,56 @@
+package content
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	cases := map[string]struct {
+		src      string
+		emojis   map[string]string
+		expected string
+	}{
+		"empty": {},
+		"mastodon status": {
+			src: `<p>Hi <span class="h-card" translate="no"><a href="https://mastodon.social/@john" class="u-url mention">@<span>john</span></a></span><br />` +
+				`<a href="https://example.com/page" target="_blank" rel="nofollow noopener noreferrer" translate="no"><span class="invisible">https://</span><span class="">example.com/page</span><span class="invisible"></span></a></p>`,
+			expected: `<p>Hi <span class="h-card"><a href="https://mastodon.social/@john" class="u-url mention" rel="nofollow noopener noreferrer">@<span>john</span></a></span><br>` +
+				`<a href="https://example.com/page" rel="nofollow noopener noreferrer"><span class="invisible">https://</span><span>example.com/page</span><span class="invisible"></span></a></p>`,
+		},
+		"scripts and handlers": {
+			src:      `<p onclick="alert(1)">text<script>alert(2)</script><style>p{}</style><iframe src="https://evil"></iframe></p>`,
+			expected: `<p>text</p>`,
+		},
+		"unsafe link": {
+			src:      `<a href="javascript:alert(1)">click</a>`,
+			expected: `<a rel="nofollow noopener noreferrer">click</a>`,
+		},
+		"unknown elements unwrapped": {
+			src:      `<h1>Title</h1><table><tr><td>cell <abbr>one</abbr></td></tr></table>`,
+			expected: `<p>Title</p>cell one`,
+		},
+		"custom emoji": {
+			src:      `<p><img src="https://host/emoji.png" alt=":blob&lt;cat:" onerror="alert(1)"></p>`,
+			expected: `<p>:blob&lt;cat:</p>`,
+		},
+		"custom emoji shortcodes": {
+			src: `<p>hi :blobcat: :unknown: :evil: <a href="https://host/:blobcat:">:blobcat:</a></p>`,
+			emojis: map[string]string{
+				"blobcat": "https://host/emoji/blobcat.png",
+				"evil":    "javascript:alert(1)",
+			},
+			expected: `<p>hi <img src="https://host/emoji/blobcat.png" alt=":blobcat:" class="custom-emoji"> :unknown: :evil: ` +
+				`<a href="https://host/:blobcat:" rel="nofollow noopener noreferrer"><img src="https://host/emoji/blobcat.png" alt=":blobcat:" class="custom-emoji"></a></p>`,
+		},
+		"text escaped": {
+			src:      `a &lt; b &amp; "c"`,
+			expected: `a &lt; b &amp; &#34;c&#34;`,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.expected, Sanitize(c.src, c.emojis))
+		})
+	}
+}
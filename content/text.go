@@ -0,0 +1,242 @@
+package content
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Text converts the status HTML to the plain text:
+//   - paragraphs are separated by the empty line, line breaks are kept,
+//   - links are expanded to the full URL, including the parts Mastodon hides in the invisible spans,
+//   - hashtags are rendered as "#tag", mentions as "@user@host",
+//   - whitespace is collapsed except in the preformatted blocks.
+func Text(src string) string {
+	if !strings.ContainsAny(src, "<&") {
+		return strings.TrimSpace(collapseSpaces(src))
+	}
+	nodes, err := parse(src)
+	if err != nil {
+		return strings.TrimSpace(collapseSpaces(src))
+	}
+	var w textWriter
+	for _, n := range nodes {
+		w.node(n)
+	}
+	return strings.TrimSpace(string(w.buf))
+}
+
+func parse(src string) ([]*html.Node, error) {
+	ctx := &html.Node{
+		Type:     html.ElementNode,
+		Data:     atom.Div.String(),
+		DataAtom: atom.Div,
+	}
+	return html.ParseFragment(strings.NewReader(src), ctx)
+}
+
+type textWriter struct {
+	buf []byte
+	// breaks is the count of the pending line breaks to write before the next text
+	breaks int
+	// pre is the depth of the preformatted elements
+	pre int
+}
+
+func (w *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+	case html.ElementNode:
+		switch n.DataAtom {
+		case atom.Script, atom.Style, atom.Template:
+			return
+		case atom.Br:
+			w.breaks++
+			return
+		case atom.A:
+			w.link(n)
+			return
+		case atom.Span:
+			if hasClass(n, "invisible") {
+				return
+			}
+		case atom.Img:
+			// custom emojis are the images with the shortcode in alt
+			w.text(attr(n, "alt"))
+			return
+		}
+		block := isBlock(n.DataAtom)
+		if block {
+			w.blockBreak(n.DataAtom)
+		}
+		if n.DataAtom == atom.Li {
+			w.text("- ")
+		}
+		if n.DataAtom == atom.Pre {
+			w.pre++
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			w.node(c)
+		}
+		if n.DataAtom == atom.Pre {
+			w.pre--
+		}
+		if block {
+			w.blockBreak(n.DataAtom)
+		}
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			w.node(c)
+		}
+	}
+}
+
+func (w *textWriter) text(s string) {
+	if w.pre == 0 {
+		s = collapseSpaces(s)
+	}
+	if s == "" {
+		return
+	}
+	if w.breaks > 0 || len(w.buf) == 0 || w.buf[len(w.buf)-1] == ' ' {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return
+		}
+	}
+	if w.breaks > 0 {
+		w.buf = []byte(strings.TrimRight(string(w.buf), " "))
+		if len(w.buf) > 0 {
+			w.buf = append(w.buf, strings.Repeat("\n", w.breaks)...)
+		}
+		w.breaks = 0
+	}
+	w.buf = append(w.buf, s...)
+}
+
+func (w *textWriter) blockBreak(a atom.Atom) {
+	breaks := 2
+	if a == atom.Li {
+		breaks = 1
+	}
+	if w.breaks < breaks {
+		w.breaks = breaks
+	}
+}
+
+func (w *textWriter) link(n *html.Node) {
+	href := attr(n, "href")
+	visible := strings.TrimSpace(collapseSpaces(innerText(n, false)))
+	switch {
+	case hasClass(n, "hashtag") || strings.HasPrefix(visible, "#"):
+		w.text(visible)
+	case hasClass(n, "mention") && strings.HasPrefix(visible, "@"):
+		w.text(mention(visible, href))
+	case !isWebUrl(href):
+		w.text(visible)
+	case visible == "" || isUrlText(innerText(n, true), href) || isUrlText(visible, href):
+		w.text(href)
+	default:
+		w.text(visible + " (" + href + ")")
+	}
+}
+
+// mention adds the host to the local mention, e.g. "@john" linked to "https://host/@john" becomes "@john@host".
+func mention(visible, href string) string {
+	if strings.Count(visible, "@") == 1 {
+		if u, err := url.Parse(href); err == nil && u.Hostname() != "" {
+			visible += "@" + u.Hostname()
+		}
+	}
+	return visible
+}
+
+// isUrlText returns true when the link text is the (possibly shortened) link URL.
+func isUrlText(txt, href string) bool {
+	txt = strings.TrimSpace(txt)
+	txt = strings.TrimSuffix(strings.TrimSuffix(txt, "…"), "...")
+	txt = trimUrlPrefix(txt)
+	return txt != "" && strings.HasPrefix(trimUrlPrefix(href), txt)
+}
+
+func trimUrlPrefix(u string) string {
+	u = strings.TrimPrefix(u, "https://")
+	u = strings.TrimPrefix(u, "http://")
+	return strings.TrimPrefix(u, "www.")
+}
+
+func isWebUrl(href string) bool {
+	u, err := url.Parse(href)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+func innerText(n *html.Node, invisible bool) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			sb.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.DataAtom == atom.Span && !invisible && hasClass(n, "invisible"):
+		case n.Type == html.ElementNode && n.DataAtom == atom.Img:
+			sb.WriteString(attr(n, "alt"))
+		default:
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Blockquote, atom.Pre, atom.Ul, atom.Ol, atom.Li,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return true
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// collapseSpaces replaces every whitespace run with the single space.
+func collapseSpaces(s string) string {
+	var sb strings.Builder
+	var space bool
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			sb.WriteByte(' ')
+			space = false
+		}
+		sb.WriteRune(r)
+	}
+	if space {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
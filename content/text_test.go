@@ -0,0 +1,72 @@
+package content
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	cases := map[string]struct {
+		src      string
+		expected string
+	}{
+		"empty": {},
+		"plain": {
+			src:      "  hello\n  world ",
+			expected: "hello world",
+		},
+		"paragraphs and line breaks": {
+			src:      "<p>First paragraph,<br />second line.</p><p>Second paragraph &amp; more.</p>",
+			expected: "First paragraph,\nsecond line.\n\nSecond paragraph & more.",
+		},
+		"shortened link": {
+			src: `<p>Read this: <a href="https://www.example.com/2024/12/20/some-very-long-article-title" target="_blank" rel="nofollow noopener noreferrer" translate="no">` +
+				`<span class="invisible">https://www.</span><span class="ellipsis">example.com/2024/12/20/some-ver</span>` +
+				`<span class="invisible">y-long-article-title</span></a></p>`,
+			expected: "Read this: https://www.example.com/2024/12/20/some-very-long-article-title",
+		},
+		"remote shortened link without spans": {
+			src:      `<p>See <a href="https://example.com/docs/page">example.com/docs/p…</a></p>`,
+			expected: "See https://example.com/docs/page",
+		},
+		"titled link": {
+			src:      `<p>See <a href="https://example.com/docs">the docs</a>.</p>`,
+			expected: "See the docs (https://example.com/docs).",
+		},
+		"mentions": {
+			src: `<p><span class="h-card" translate="no"><a href="https://mastodon.social/@Gargron" class="u-url mention">@<span>Gargron</span></a></span> ` +
+				`<span class="h-card" translate="no"><a href="https://mastodon.social/@john" class="u-url mention">@<span>john@host2.social</span></a></span> hi</p>`,
+			expected: "@Gargron@mastodon.social @john@host2.social hi",
+		},
+		"hashtags": {
+			src: `<p>Nice weather <a href="https://mastodon.social/tags/Photography" class="mention hashtag" rel="tag">#<span>Photography</span></a> ` +
+				`<a href="https://mastodon.social/tags/nature" class="mention hashtag" rel="tag">#<span>nature</span></a></p>`,
+			expected: "Nice weather #Photography #nature",
+		},
+		"lists and quotes": {
+			src:      "<p>Todo:</p><ul><li>one</li><li><strong>two</strong></li></ul><blockquote><p>quoted</p></blockquote>",
+			expected: "Todo:\n\n- one\n- two\n\nquoted",
+		},
+		"preformatted": {
+			src:      "<p>Code:</p><pre><code>if x {\n    y()\n}</code></pre>",
+			expected: "Code:\n\nif x {\n    y()\n}",
+		},
+		"custom emoji": {
+			src:      `<p>Hello <img src="https://host/emoji.png" alt=":blobcat:" class="custom-emoji"> world</p>`,
+			expected: "Hello :blobcat: world",
+		},
+		"script": {
+			src:      "<p>text<script>alert(1)</script></p>",
+			expected: "text",
+		},
+		"entities": {
+			src:      "<p>&lt;b&gt; isn&#39;t bold&nbsp;here</p>",
+			expected: "<b> isn't bold here",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.expected, Text(c.src))
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type lru struct {
+	lock  *sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key     string
+	expires time.Time
+}
+
+func NewStorageLru(size int, ttl time.Duration) Storage {
+	return lru{
+		lock:  &sync.Mutex{},
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+func (l lru) Add(ctx context.Context, key string) (added bool, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	e, found := l.items[key]
+	switch {
+	case found && e.Value.(lruItem).expires.After(now):
+		l.order.MoveToFront(e)
+	case found:
+		e.Value = lruItem{
+			key:     key,
+			expires: now.Add(l.ttl),
+		}
+		l.order.MoveToFront(e)
+		added = true
+	default:
+		l.items[key] = l.order.PushFront(lruItem{
+			key:     key,
+			expires: now.Add(l.ttl),
+		})
+		added = true
+		for l.order.Len() > l.size {
+			oldest := l.order.Back()
+			l.order.Remove(oldest)
+			delete(l.items, oldest.Value.(lruItem).key)
+		}
+	}
+	return
+}
+
+func (l lru) Delete(ctx context.Context, key string) (err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if e, found := l.items[key]; found {
+		l.order.Remove(e)
+		delete(l.items, key)
+	}
+	return
+}
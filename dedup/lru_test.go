@@ -0,0 +1,54 @@
+package dedup
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLru_Add(t *testing.T) {
+	stor := NewStorageLru(2, 100*time.Millisecond)
+	ctx := context.TODO()
+	cases := []struct {
+		key   string
+		delay time.Duration
+		added bool
+	}{
+		{key: "a", added: true},
+		{key: "a"},
+		{key: "b", added: true},
+		{key: "a"},
+		// evicts "b" as the least recently used
+		{key: "c", added: true},
+		{key: "a"},
+		{key: "b", added: true},
+		// "c" is evicted when "b" is added back
+		{key: "c", added: true},
+		// expired
+		{key: "c", delay: 100 * time.Millisecond, added: true},
+		{key: "c"},
+	}
+	for i, c := range cases {
+		time.Sleep(c.delay)
+		added, err := stor.Add(ctx, c.key)
+		require.NoError(t, err)
+		assert.Equal(t, c.added, added, "step %d, key %s", i, c.key)
+	}
+}
+
+func TestLru_Delete(t *testing.T) {
+	stor := NewStorageLru(2, time.Minute)
+	ctx := context.TODO()
+	added, err := stor.Add(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, added)
+	err = stor.Delete(ctx, "a")
+	require.NoError(t, err)
+	err = stor.Delete(ctx, "b")
+	require.NoError(t, err)
+	added, err = stor.Add(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, added)
+}
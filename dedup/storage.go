@@ -0,0 +1,14 @@
+package dedup
+
+import "context"
+
+// Storage remembers the recently seen keys. The in-memory implementation is sufficient for a single replica,
+// a shared store implementing this interface allows to deduplicate across the replicas.
+type Storage interface {
+
+	// Add remembers the key. Returns false if the key is already known.
+	Add(ctx context.Context, key string) (added bool, err error)
+
+	// Delete forgets the key, e.g. when the keyed item failed to process and should be accepted again.
+	Delete(ctx context.Context, key string) (err error)
+}
@@ -0,0 +1,47 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+)
+
+// errAddrNotPublic means the instance domain resolves to the loopback, private or another internal address.
+var errAddrNotPublic = errors.New("address is not public")
+
+// prefixSharedAddrSpace is the carrier-grade NAT range, often used for the internal cluster addresses.
+var prefixSharedAddrSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// NewClientHttp returns the client connecting to the public addresses only. The instance domain comes from the remote
+// account, so the check happens on every dial after the name resolution, including the redirects.
+func NewClientHttp() *http.Client {
+	dialer := &net.Dialer{
+		Control: controlPublic,
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// the proxy would resolve and dial the instance instead
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: t,
+	}
+}
+
+func controlPublic(network, address string, _ syscall.RawConn) (err error) {
+	var addrPort netip.AddrPort
+	addrPort, err = netip.ParseAddrPort(address)
+	if err == nil && !public(addrPort.Addr()) {
+		err = fmt.Errorf("%w: %s", errAddrNotPublic, addrPort.Addr())
+	}
+	return
+}
+
+func public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!prefixSharedAddrSpace.Contains(addr)
+}
@@ -0,0 +1,108 @@
+package instance
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/awakari/int-mastodon/model"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// domains is the set of domains matching the subdomains too.
+type domains map[string]struct{}
+
+func newDomains(src []string) (ds domains) {
+	ds = make(domains)
+	for _, d := range src {
+		d = normalize(d)
+		if d != "" {
+			ds[d] = struct{}{}
+		}
+	}
+	return
+}
+
+func (ds domains) match(domain string) (matched string, ok bool) {
+	domain = normalize(domain)
+	for domain != "" {
+		if _, ok = ds[domain]; ok {
+			matched = domain
+			return
+		}
+		_, domain, _ = strings.Cut(domain, ".")
+	}
+	return
+}
+
+func normalize(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// Domains returns the instance domains of the account: the one of the account address and the one of the actor URI.
+// These may differ when the instance uses the separate domain for the account addresses.
+func Domains(acc model.Account) (ds []string) {
+	if _, d, found := strings.Cut(strings.TrimPrefix(acc.Acct, "@"), "@"); found && d != "" {
+		ds = append(ds, normalize(d))
+	}
+	if u, err := url.Parse(acc.Uri); err == nil && u.Hostname() != "" {
+		d := normalize(u.Hostname())
+		if len(ds) == 0 || ds[0] != d {
+			ds = append(ds, d)
+		}
+	}
+	return
+}
+
+var ErrInvalidCsv = errors.New("invalid domain block list")
+
+const csvSeveritySuspend = "suspend"
+const csvSeveritySilence = "silence"
+
+// ReadBlockCsv reads the domains from the domain block list in the Mastodon export format, e.g.:
+//
+//	#domain,#severity,#reject_media,#reject_reports,#public_comment,#obfuscate
+//	example.com,suspend,false,false,,false
+//
+// The header is optional. The entries having the severity other than "suspend" or "silence" are skipped,
+// the obfuscated ones (containing "*") either.
+func ReadBlockCsv(r io.Reader) (ds []string, err error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = 0
+	idxSeverity := -1
+	var rec []string
+	for line := 0; ; line++ {
+		rec, err = cr.Read()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("%w: %s", ErrInvalidCsv, err)
+			break
+		}
+		if line == 0 && strings.HasPrefix(rec[0], "#") {
+			for i, col := range rec {
+				if strings.TrimPrefix(col, "#") == "severity" {
+					idxSeverity = i
+				}
+			}
+			continue
+		}
+		d := normalize(rec[0])
+		if d == "" || strings.Contains(d, "*") {
+			continue
+		}
+		if idxSeverity >= 0 && idxSeverity < len(rec) {
+			switch strings.TrimSpace(rec[idxSeverity]) {
+			case csvSeveritySuspend, csvSeveritySilence:
+			default:
+				continue
+			}
+		}
+		ds = append(ds, d)
+	}
+	return
+}
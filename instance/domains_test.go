@@ -0,0 +1,94 @@
+package instance
+
+import (
+	"github.com/awakari/int-mastodon/model"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDomains(t *testing.T) {
+	cases := map[string]struct {
+		acc      model.Account
+		expected []string
+	}{
+		"remote": {
+			acc: model.Account{
+				Acct: "john@Host2.social",
+				Uri:  "https://host2.social/users/john",
+			},
+			expected: []string{"host2.social"},
+		},
+		"separate account domain": {
+			acc: model.Account{
+				Acct: "john@example.com",
+				Uri:  "https://social.example.com/users/john",
+			},
+			expected: []string{"example.com", "social.example.com"},
+		},
+		"local": {
+			acc: model.Account{
+				Acct: "john",
+				Uri:  "https://host1/users/john",
+			},
+			expected: []string{"host1"},
+		},
+		"empty": {},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.expected, Domains(c.acc))
+		})
+	}
+}
+
+func TestDomains_match(t *testing.T) {
+	ds := newDomains([]string{"Example.com", " ", "host1."})
+	cases := map[string]string{
+		"example.com":        "example.com",
+		"social.example.com": "example.com",
+		"example.com.":       "example.com",
+		"host1":              "host1",
+		"notexample.com":     "",
+		"com":                "",
+	}
+	for domain, expected := range cases {
+		t.Run(domain, func(t *testing.T) {
+			matched, ok := ds.match(domain)
+			assert.Equal(t, expected != "", ok)
+			assert.Equal(t, expected, matched)
+		})
+	}
+}
+
+func TestReadBlockCsv(t *testing.T) {
+	cases := map[string]struct {
+		src      string
+		expected []string
+		err      error
+	}{
+		"mastodon export": {
+			src: "#domain,#severity,#reject_media,#reject_reports,#public_comment,#obfuscate\n" +
+				"spam.example,suspend,false,false,spam,false\n" +
+				"loud.example,silence,true,false,,false\n" +
+				"media.example,noop,true,false,,false\n" +
+				"obf*scated.example,suspend,false,false,,true\n",
+			expected: []string{"spam.example", "loud.example"},
+		},
+		"domains only": {
+			src:      "spam.example\nLoud.Example\n\n",
+			expected: []string{"spam.example", "loud.example"},
+		},
+		"invalid": {
+			src: "\"spam.example\n",
+			err: ErrInvalidCsv,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			ds, err := ReadBlockCsv(strings.NewReader(c.src))
+			assert.ErrorIs(t, err, c.err)
+			assert.Equal(t, c.expected, ds)
+		})
+	}
+}
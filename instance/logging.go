@@ -0,0 +1,26 @@
+package instance
+
+import (
+	"context"
+	"fmt"
+	"github.com/awakari/int-mastodon/model"
+	"log/slog"
+)
+
+type logging struct {
+	svc Service
+	log *slog.Logger
+}
+
+func NewLogging(svc Service, log *slog.Logger) Service {
+	return logging{
+		svc: svc,
+		log: log,
+	}
+}
+
+func (l logging) Check(ctx context.Context, domain string) (d model.Decision) {
+	d = l.svc.Check(ctx, domain)
+	l.log.Debug(fmt.Sprintf("instance.Check(%s): %s", domain, d))
+	return
+}
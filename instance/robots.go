@@ -0,0 +1,74 @@
+package instance
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+type robotsGroup struct {
+	agents       []string
+	disallowRoot bool
+	allowRoot    bool
+}
+
+// robotsDisallowed returns true if the robots.txt disallows the whole site for the user agent. The group naming the
+// user agent takes precedence over the "*" one.
+func robotsDisallowed(r io.Reader, userAgent string) (disallowed bool) {
+	ua := strings.ToLower(userAgent)
+	var groups []*robotsGroup
+	var g *robotsGroup
+	var rules bool
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		k, v, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		k = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		switch k {
+		case "user-agent":
+			if g == nil || rules {
+				g = &robotsGroup{}
+				groups = append(groups, g)
+				rules = false
+			}
+			g.agents = append(g.agents, strings.ToLower(v))
+		case "disallow":
+			if g != nil {
+				rules = true
+				g.disallowRoot = g.disallowRoot || v == "/"
+			}
+		case "allow":
+			if g != nil {
+				rules = true
+				g.allowRoot = g.allowRoot || v == "/"
+			}
+		}
+	}
+	var gSpecific, gAny *robotsGroup
+	for _, g = range groups {
+		for _, a := range g.agents {
+			switch {
+			case a == "*":
+				if gAny == nil {
+					gAny = g
+				}
+			case a != "" && strings.Contains(ua, a):
+				if gSpecific == nil {
+					gSpecific = g
+				}
+			}
+		}
+	}
+	g = gSpecific
+	if g == nil {
+		g = gAny
+	}
+	if g != nil {
+		disallowed = g.disallowRoot && !g.allowRoot
+	}
+	return
+}
@@ -0,0 +1,41 @@
+package instance
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestRobotsDisallowed(t *testing.T) {
+	cases := map[string]struct {
+		src        string
+		disallowed bool
+	}{
+		"empty": {},
+		"mastodon default": {
+			src: "# See https://www.robotstxt.org/robotstxt.html\n\nUser-agent: *\nDisallow: /media_proxy/\nDisallow: /interact/\n",
+		},
+		"disallow all": {
+			src:        "User-agent: *\nDisallow: /\n",
+			disallowed: true,
+		},
+		"disallow specific": {
+			src:        "User-agent: GPTBot\nUser-agent: Awakari\nDisallow: / # no thanks\n\nUser-agent: *\nDisallow:\n",
+			disallowed: true,
+		},
+		"specific group overrides any": {
+			src: "User-agent: *\nDisallow: /\n\nUser-agent: awakari\nAllow: /\n",
+		},
+		"other agent disallowed": {
+			src: "User-agent: GPTBot\nDisallow: /\n",
+		},
+		"disallow path only": {
+			src: "User-agent: awakari\nDisallow: /users/\n",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.disallowed, robotsDisallowed(strings.NewReader(c.src), "Awakari"))
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package instance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/int-mastodon/config"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/bytedance/sonic"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Service decides whether the content from the remote instance may be consumed.
+type Service interface {
+
+	// Check returns the decision for the instance domain, e.g. "mastodon.social".
+	Check(ctx context.Context, domain string) (d model.Decision)
+}
+
+type service struct {
+	clientHttp *http.Client
+	userAgent  string
+	protocol   string
+	cfg        config.InstanceConfig
+	block      domains
+	allow      domains
+	cache      *cache
+	fetches    *flights
+}
+
+const pathRobots = "/robots.txt"
+const pathNodeInfo = "/.well-known/nodeinfo"
+const limitRespBodyLen = 65_536
+
+var errUnexpectedResponse = errors.New("unexpected response")
+
+// errNotFound means the metadata is missing for sure, unlike the other fetch failures.
+var errNotFound = errors.New("not found")
+
+func NewService(clientHttp *http.Client, userAgent, protocol string, cfg config.InstanceConfig) (svc Service, err error) {
+	block := cfg.Block
+	if cfg.BlockCsv != "" {
+		var f *os.File
+		f, err = os.Open(cfg.BlockCsv)
+		if err == nil {
+			defer f.Close()
+			var blockCsv []string
+			blockCsv, err = ReadBlockCsv(f)
+			block = append(block, blockCsv...)
+		}
+	}
+	if err == nil {
+		svc = service{
+			clientHttp: clientHttp,
+			userAgent:  userAgent,
+			protocol:   protocol,
+			cfg:        cfg,
+			block:      newDomains(block),
+			allow:      newDomains(cfg.Allow),
+			cache:      newCache(int(cfg.Cache.Size)),
+			fetches:    newFlights(),
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to load the domain block list %s: %w", cfg.BlockCsv, err)
+	}
+	return
+}
+
+func (svc service) Check(ctx context.Context, domain string) (d model.Decision) {
+	domain = normalize(domain)
+	if matched, blocked := svc.block.match(domain); blocked {
+		return model.Reject(model.ReasonInstanceBlocked, fmt.Sprintf("domain %s is blocked by %s", domain, matched))
+	}
+	if _, allowed := svc.allow.match(domain); len(svc.allow) > 0 && !allowed {
+		return model.Reject(model.ReasonInstanceNotAllowed, fmt.Sprintf("domain %s is not in the allow list", domain))
+	}
+	if !svc.cfg.Robots.Enabled && !svc.cfg.NodeInfo.Enabled {
+		return model.Accept()
+	}
+	var found bool
+	d, found = svc.cache.get(domain)
+	if !found {
+		// the concurrent checks of the same domain wait for the single fetch
+		d = svc.fetches.do(ctx, domain, func() (d model.Decision) {
+			if dCached, cached := svc.cache.get(domain); cached {
+				return dCached
+			}
+			ctxFetch, cancel := context.WithTimeout(ctx, svc.cfg.Timeout)
+			defer cancel()
+			var complete bool
+			d, complete = svc.checkRemote(ctxFetch, domain)
+			ttl := svc.cfg.Cache.Ttl
+			if !complete {
+				// retry the failed fetch sooner
+				ttl = svc.cfg.Cache.TtlFailure
+			}
+			svc.cache.put(domain, d, ttl)
+			return
+		})
+	}
+	return
+}
+
+// checkRemote fetches the instance metadata. The unavailable metadata doesn't opt the instance out, but the decision
+// is not complete when any fetch failed for another reason than the missing metadata.
+func (svc service) checkRemote(ctx context.Context, domain string) (d model.Decision, complete bool) {
+	d = model.Accept()
+	complete = true
+	if svc.cfg.Robots.Enabled {
+		data, err := svc.fetch(ctx, svc.protocol+domain+pathRobots)
+		if err == nil && robotsDisallowed(bytes.NewReader(data), svc.userAgent) {
+			return model.Reject(model.ReasonRobots, fmt.Sprintf("%s%s disallows %s", domain, pathRobots, svc.userAgent)), true
+		}
+		if errors.Is(err, errAddrNotPublic) {
+			return rejectNotPublic(domain, err), true
+		}
+		complete = err == nil || errors.Is(err, errNotFound)
+	}
+	if svc.cfg.NodeInfo.Enabled {
+		ni, err := svc.fetchNodeInfo(ctx, domain)
+		switch {
+		case err == nil:
+			d = svc.checkNodeInfo(domain, ni)
+			if !d.Accepted {
+				complete = true
+			}
+		case errors.Is(err, errAddrNotPublic):
+			return rejectNotPublic(domain, err), true
+		case !errors.Is(err, errNotFound):
+			complete = false
+		}
+	}
+	return
+}
+
+func rejectNotPublic(domain string, err error) model.Decision {
+	return model.Reject(model.ReasonInstanceBlocked, fmt.Sprintf("domain %s is not public: %s", domain, err))
+}
+
+type nodeInfoLinks struct {
+	Links []struct {
+		Rel  string `json:"rel"`
+		Href string `json:"href"`
+	} `json:"links"`
+}
+
+type nodeInfo struct {
+	Software struct {
+		Name string `json:"name"`
+	} `json:"software"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+func (svc service) fetchNodeInfo(ctx context.Context, domain string) (ni nodeInfo, err error) {
+	var data []byte
+	data, err = svc.fetch(ctx, svc.protocol+domain+pathNodeInfo)
+	var links nodeInfoLinks
+	if err == nil {
+		err = sonic.Unmarshal(data, &links)
+	}
+	var href string
+	if err == nil {
+		// the latest schema version is usually the last one
+		for _, l := range links.Links {
+			u, errParse := url.Parse(l.Href)
+			// don't follow the links to other hosts
+			if errParse == nil && strings.HasPrefix(l.Rel, "http://nodeinfo.diaspora.software/ns/schema/") && normalize(u.Hostname()) == domain {
+				href = l.Href
+			}
+		}
+		if href == "" {
+			err = fmt.Errorf("%w: no nodeinfo link for %s", errUnexpectedResponse, domain)
+		}
+	}
+	if err == nil {
+		data, err = svc.fetch(ctx, href)
+	}
+	if err == nil {
+		err = sonic.Unmarshal(data, &ni)
+	}
+	return
+}
+
+func (svc service) checkNodeInfo(domain string, ni nodeInfo) (d model.Decision) {
+	d = model.Accept()
+	sw := strings.ToLower(ni.Software.Name)
+	if sw != "" && slices.ContainsFunc(svc.cfg.NodeInfo.Software, func(blocked string) bool {
+		return strings.EqualFold(blocked, sw)
+	}) {
+		return model.Reject(model.ReasonNodeInfo, fmt.Sprintf("%s software %s is blocked", domain, sw))
+	}
+	for _, k := range svc.cfg.NodeInfo.OptOut {
+		if v, ok := ni.Metadata[k].(bool); ok && v {
+			return model.Reject(model.ReasonNodeInfo, fmt.Sprintf("%s nodeinfo metadata %s is set", domain, k))
+		}
+	}
+	return
+}
+
+func (svc service) fetch(ctx context.Context, u string) (data []byte, err error) {
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	var resp *http.Response
+	if err == nil {
+		req.Header.Add("User-Agent", svc.userAgent)
+		resp, err = svc.clientHttp.Do(req)
+	}
+	if err == nil {
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			data, err = io.ReadAll(io.LimitReader(resp.Body, limitRespBodyLen))
+		case http.StatusNotFound, http.StatusGone:
+			err = fmt.Errorf("%w: %s", errNotFound, u)
+		default:
+			err = fmt.Errorf("%w: %s %d", errUnexpectedResponse, u, resp.StatusCode)
+		}
+	}
+	return
+}
+
+type cache struct {
+	lock  sync.Mutex
+	size  int
+	items map[string]cacheItem
+}
+
+type cacheItem struct {
+	d       model.Decision
+	expires time.Time
+}
+
+func newCache(size int) *cache {
+	return &cache{
+		size:  size,
+		items: make(map[string]cacheItem),
+	}
+}
+
+func (c *cache) get(domain string) (d model.Decision, found bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var item cacheItem
+	item, found = c.items[domain]
+	if found && item.expires.Before(time.Now()) {
+		delete(c.items, domain)
+		found = false
+	}
+	d = item.d
+	return
+}
+
+func (c *cache) put(domain string, d model.Decision, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	if len(c.items) >= c.size {
+		// evict the expired items first, then any
+		for k, item := range c.items {
+			if item.expires.Before(now) {
+				delete(c.items, k)
+			}
+		}
+		for k := range c.items {
+			if len(c.items) < c.size {
+				break
+			}
+			delete(c.items, k)
+		}
+	}
+	if c.size > 0 {
+		c.items[domain] = cacheItem{
+			d:       d,
+			expires: now.Add(ttl),
+		}
+	}
+}
+
+// flights deduplicates the concurrent calls for the same key.
+type flights struct {
+	lock  sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done chan struct{}
+	d    model.Decision
+}
+
+func newFlights() *flights {
+	return &flights{
+		calls: make(map[string]*flight),
+	}
+}
+
+// do calls the function unless it's already in flight for the same key, otherwise waits for its result.
+// The waiting caller gets the acceptance when its context is done first, same as for the unavailable metadata.
+func (f *flights) do(ctx context.Context, key string, fn func() model.Decision) (d model.Decision) {
+	f.lock.Lock()
+	c, found := f.calls[key]
+	if !found {
+		c = &flight{
+			done: make(chan struct{}),
+		}
+		f.calls[key] = c
+	}
+	f.lock.Unlock()
+	if found {
+		select {
+		case <-c.done:
+			d = c.d
+		case <-ctx.Done():
+			d = model.Accept()
+		}
+		return
+	}
+	defer func() {
+		f.lock.Lock()
+		delete(f.calls, key)
+		f.lock.Unlock()
+		close(c.done)
+	}()
+	c.d = fn()
+	d = c.d
+	return
+}
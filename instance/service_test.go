@@ -0,0 +1,231 @@
+package instance
+
+import (
+	"context"
+	"fmt"
+	"github.com/awakari/int-mastodon/config"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestService_Check(t *testing.T) {
+	var countReqs atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		countReqs.Add(1)
+		host := r.Host
+		switch r.URL.Path {
+		case pathRobots:
+			if strings.HasPrefix(host, "robots.") {
+				_, _ = w.Write([]byte("User-agent: *\nDisallow: /\n"))
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case pathNodeInfo:
+			_, _ = fmt.Fprintf(w, `{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.0","href":"http://%s/nodeinfo/2.0"}]}`, host)
+		case "/nodeinfo/2.0":
+			switch {
+			case strings.HasPrefix(host, "noindex."):
+				_, _ = w.Write([]byte(`{"software":{"name":"mastodon"},"metadata":{"noindex":true}}`))
+			case strings.HasPrefix(host, "software."):
+				_, _ = w.Write([]byte(`{"software":{"name":"BadSoftware"},"metadata":{}}`))
+			default:
+				_, _ = w.Write([]byte(`{"software":{"name":"mastodon"},"metadata":{"noindex":false}}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	// route every domain to the test server
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	clientHttp := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (conn net.Conn, err error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		},
+	}
+	dir := t.TempDir()
+	pathCsv := filepath.Join(dir, "blocks.csv")
+	require.NoError(t, os.WriteFile(pathCsv, []byte("#domain,#severity\ncsv.example,suspend\n"), 0644))
+	cfg := config.InstanceConfig{
+		Block:    []string{"blocked.example"},
+		BlockCsv: pathCsv,
+		Timeout:  time.Second,
+	}
+	cfg.Robots.Enabled = true
+	cfg.NodeInfo.Enabled = true
+	cfg.NodeInfo.Software = []string{"badsoftware"}
+	cfg.NodeInfo.OptOut = []string{"noindex"}
+	cfg.Cache.Size = 10
+	cfg.Cache.Ttl = time.Minute
+	svc, err := NewService(clientHttp, "awakari", "http://", cfg)
+	require.NoError(t, err)
+	cases := map[string]struct {
+		domain string
+		reason model.Reason
+		reqs   int32
+	}{
+		"ok": {
+			domain: "ok.example",
+			reqs:   3,
+		},
+		"blocked": {
+			domain: "blocked.example",
+			reason: model.ReasonInstanceBlocked,
+		},
+		"blocked subdomain": {
+			domain: "social.blocked.example",
+			reason: model.ReasonInstanceBlocked,
+		},
+		"blocked by csv": {
+			domain: "csv.example",
+			reason: model.ReasonInstanceBlocked,
+		},
+		"robots": {
+			domain: "robots.example",
+			reason: model.ReasonRobots,
+			reqs:   1,
+		},
+		"nodeinfo metadata": {
+			domain: "noindex.example",
+			reason: model.ReasonNodeInfo,
+			reqs:   3,
+		},
+		"nodeinfo software": {
+			domain: "software.example",
+			reason: model.ReasonNodeInfo,
+			reqs:   3,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			countReqs.Store(0)
+			d := svc.Check(context.TODO(), c.domain)
+			assert.Equal(t, c.reason == model.ReasonNone, d.Accepted)
+			assert.Equal(t, c.reason, d.Reason)
+			assert.Equal(t, c.reqs, countReqs.Load())
+			// cached
+			assert.Equal(t, d, svc.Check(context.TODO(), c.domain))
+			assert.Equal(t, c.reqs, countReqs.Load())
+		})
+	}
+}
+
+func TestService_Check_Failure(t *testing.T) {
+	var countReqs atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		countReqs.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	clientHttp := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (conn net.Conn, err error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		},
+	}
+	cfg := config.InstanceConfig{
+		Timeout: time.Second,
+	}
+	cfg.Robots.Enabled = true
+	cfg.Cache.Size = 10
+	cfg.Cache.Ttl = time.Hour
+	cfg.Cache.TtlFailure = 200 * time.Millisecond
+	svc, err := NewService(clientHttp, "awakari", "http://", cfg)
+	require.NoError(t, err)
+	// concurrent checks share the single fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.True(t, svc.Check(context.TODO(), "down.example").Accepted)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), countReqs.Load())
+	// the failure is cached for a short time only
+	assert.True(t, svc.Check(context.TODO(), "down.example").Accepted)
+	assert.Equal(t, int32(1), countReqs.Load())
+	time.Sleep(300 * time.Millisecond)
+	assert.True(t, svc.Check(context.TODO(), "down.example").Accepted)
+	assert.Equal(t, int32(2), countReqs.Load())
+}
+
+func TestService_Check_Allow(t *testing.T) {
+	cfg := config.InstanceConfig{
+		Allow: []string{"allowed.example"},
+	}
+	svc, err := NewService(http.DefaultClient, "awakari", "http://", cfg)
+	require.NoError(t, err)
+	assert.True(t, svc.Check(context.TODO(), "social.allowed.example").Accepted)
+	assert.Equal(t, model.ReasonInstanceNotAllowed, svc.Check(context.TODO(), "other.example").Reason)
+}
+
+func TestNewService_InvalidCsv(t *testing.T) {
+	cfg := config.InstanceConfig{
+		BlockCsv: filepath.Join(t.TempDir(), "missing.csv"),
+	}
+	_, err := NewService(http.DefaultClient, "awakari", "http://", cfg)
+	assert.Error(t, err)
+}
+
+func TestService_Check_NotPublic(t *testing.T) {
+	cfg := config.InstanceConfig{
+		Timeout: time.Second,
+	}
+	cfg.Robots.Enabled = true
+	cfg.NodeInfo.Enabled = true
+	cfg.Cache.Size = 10
+	cfg.Cache.Ttl = time.Minute
+	svc, err := NewService(NewClientHttp(), "awakari", "http://", cfg)
+	require.NoError(t, err)
+	for _, domain := range []string{"localhost", "127.0.0.1", "10.0.0.1", "169.254.169.254"} {
+		t.Run(domain, func(t *testing.T) {
+			d := svc.Check(context.TODO(), domain)
+			assert.False(t, d.Accepted)
+			assert.Equal(t, model.ReasonInstanceBlocked, d.Reason)
+		})
+	}
+}
+
+func TestPublic(t *testing.T) {
+	cases := map[string]bool{
+		"1.1.1.1":              true,
+		"2606:4700::1111":      true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"100.64.0.1":           false,
+		"169.254.169.254":      false,
+		"fe80::1":              false,
+		"fd00::1":              false,
+		"0.0.0.0":              false,
+		"224.0.0.1":            false,
+		"::ffff:192.168.1.1":   false,
+		"::ffff:93.184.215.14": true,
+	}
+	for k, expected := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, expected, public(netip.MustParseAddr(k)))
+		})
+	}
+}
@@ -2,21 +2,34 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	apiGrpc "github.com/awakari/int-mastodon/api/grpc"
 	apiGrpcAp "github.com/awakari/int-mastodon/api/grpc/int-activitypub"
 	"github.com/awakari/int-mastodon/api/grpc/queue"
+	"github.com/awakari/int-mastodon/api/http/mastodon"
 	"github.com/awakari/int-mastodon/api/http/pub"
+	"github.com/awakari/int-mastodon/api/http/ratelimit"
+	"github.com/awakari/int-mastodon/api/http/stream"
 	"github.com/awakari/int-mastodon/config"
+	"github.com/awakari/int-mastodon/dedup"
+	"github.com/awakari/int-mastodon/instance"
 	"github.com/awakari/int-mastodon/model"
+	"github.com/awakari/int-mastodon/policy"
 	"github.com/awakari/int-mastodon/service"
+	"github.com/awakari/int-mastodon/storage"
+	"github.com/awakari/int-mastodon/supervisor"
 	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const ceKeyGroupId = "awakarigroupid"
@@ -24,6 +37,14 @@ const ceKeyQueriesCompl = "queriescompl"
 const ceKeyPublic = "public"
 const ceKeyDiscover = "discover"
 
+type interestOp int
+
+const (
+	interestCreated interestOp = iota
+	interestUpdated
+	interestDeleted
+)
+
 func main() {
 	//
 	cfg, err := config.NewConfigFromEnv()
@@ -37,8 +58,18 @@ func main() {
 	log := slog.New(slog.NewTextHandler(os.Stdout, &opts))
 	log.Info("starting the update for the feeds")
 
-	svcPub := pub.NewService(http.DefaultClient, cfg.Api.Writer.Uri, cfg.Api.Token.Internal, cfg.Api.Writer.Timeout)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	sv := supervisor.NewSupervisor(ctx, cfg.Api.Queue.BackoffError, log)
+
+	svcPub := pub.NewService(http.DefaultClient, cfg.Api.Writer.Uri, cfg.Api.Writer.UriBatch, cfg.Api.Token.Internal, cfg.Api.Writer.Timeout)
 	svcPub = pub.NewLogging(svcPub, log)
+	deadLetter := pub.NewDeadLetterLog(log)
+	if cfg.Api.Writer.DeadLetter.Path != "" {
+		deadLetter = pub.NewDeadLetterFile(cfg.Api.Writer.DeadLetter.Path)
+	}
+	svcPub = pub.NewRetrying(svcPub, cfg.Api.Writer.Retry.Count, cfg.Api.Writer.Retry.BackoffMin, cfg.Api.Writer.Backoff, deadLetter)
+	svcPub = pub.NewDedup(svcPub, dedup.NewStorageLru(int(cfg.Api.Writer.Dedup.Size), cfg.Api.Writer.Dedup.Ttl), cfg.Api.Writer.Dedup.ReportInterval, log)
 	log.Info("initialized the Awakari API client")
 	connAp, err := grpc.NewClient(cfg.Api.ActivityPub.Uri, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
@@ -49,8 +80,51 @@ func main() {
 	svcActivityPub := apiGrpcAp.NewService(clientAp)
 	svcActivityPub = apiGrpcAp.NewServiceLogging(svcActivityPub, log)
 
+	if cfg.Api.Mastodon.Tags.Enabled && cfg.Storage.Path == "" {
+		// the followed hashtags and the timeline cursors would be lost on restart, and the statuses re-published
+		panic("the hashtag timelines polling requires the persistent storage path")
+	}
+	stor := storage.NewStorageMemory(cfg.Storage.TtlRejected)
+	if cfg.Storage.Path != "" {
+		stor, err = storage.NewStorageFile(cfg.Storage.Path, cfg.Storage.TtlRejected)
+		if err != nil {
+			panic(err)
+		}
+	}
+	defer stor.Close()
+	log.Info("initialized the sources storage")
+
+	pol, err := policy.NewPolicy(cfg.Api.Mastodon)
+	if err != nil {
+		panic(err)
+	}
+
 	clientHttp := &http.Client{}
-	svc := service.NewService(clientHttp, cfg.Api.Mastodon.Client.UserAgent, cfg.Api.Mastodon, svcActivityPub, svcPub, cfg.Api.Event.Type)
+	svcInstance, err := instance.NewService(instance.NewClientHttp(), cfg.Api.Mastodon.Client.UserAgent, cfg.Api.Mastodon.Endpoint.Protocol, cfg.Api.Mastodon.Instance)
+	if err != nil {
+		panic(err)
+	}
+	svcInstance = instance.NewLogging(svcInstance, log)
+
+	// the streaming and the instance metadata requests are not rate limited
+	clientMastodon := &http.Client{
+		Transport: ratelimit.NewTransport(
+			http.DefaultTransport,
+			cfg.Api.Mastodon.Client.RateLimit.Reserve,
+			cfg.Api.Mastodon.Client.RateLimit.WaitMax,
+			log,
+		),
+	}
+	clientApiMastodon := mastodon.NewClient(
+		clientMastodon,
+		cfg.Api.Mastodon.Client.UserAgent,
+		cfg.Api.Mastodon.Endpoint.Protocol,
+		cfg.Api.Mastodon.Endpoint.Accounts,
+		cfg.Api.Mastodon.Endpoint.Search,
+		cfg.Api.Mastodon.Endpoint.Tags,
+	)
+	clientApiMastodon = mastodon.NewLogging(clientApiMastodon, log)
+	svc := service.NewService(clientApiMastodon, cfg.Api.Mastodon, svcActivityPub, svcPub, cfg.Api.Event.Type, cfg.Api.Event.TypeDelete, pol, svcInstance, stor, log)
 	svc = service.NewServiceLogging(svc, log)
 
 	// init queues
@@ -62,78 +136,107 @@ func main() {
 	clientQueue := queue.NewServiceClient(connQueue)
 	svcQueue := queue.NewService(clientQueue)
 	svcQueue = queue.NewLoggingMiddleware(svcQueue, log)
+	// shared by the interest event consumers, the event ids are unique
+	att := newAttempts()
 
-	err = svcQueue.SetConsumer(context.TODO(), cfg.Api.Queue.InterestsCreated.Name, cfg.Api.Queue.InterestsCreated.Subj)
-	if err != nil {
-		panic(err)
-	}
-	log.Info(fmt.Sprintf("initialized the %s queue", cfg.Api.Queue.InterestsCreated.Name))
-	go func() {
-		err = consumeQueue(
-			context.Background(),
+	sv.Go(cfg.Api.Queue.InterestsCreated.Subj, func(ctx context.Context) (err error) {
+		return consumeQueue(
+			ctx,
 			svc,
 			svcQueue,
 			cfg.Api.Queue.InterestsCreated.Name,
 			cfg.Api.Queue.InterestsCreated.Subj,
 			cfg.Api.Queue.InterestsCreated.BatchSize,
-			func(ctx context.Context, svc service.Service, evts []*pb.CloudEvent) {
-				consumeInterestEvents(ctx, svc, evts, cfg, log)
+			func(ctx context.Context, svc service.Service, evts []*pb.CloudEvent) (n uint32, err error) {
+				return consumeInterestEvents(ctx, svc, evts, interestCreated, cfg, att, log)
 			},
 		)
-		if err != nil {
-			panic(err)
-		}
-	}()
-
-	err = svcQueue.SetConsumer(context.TODO(), cfg.Api.Queue.InterestsUpdated.Name, cfg.Api.Queue.InterestsUpdated.Subj)
-	if err != nil {
-		panic(err)
-	}
-	log.Info(fmt.Sprintf("initialized the %s queue", cfg.Api.Queue.InterestsUpdated.Name))
-	go func() {
-		err = consumeQueue(
-			context.Background(),
+	})
+	sv.Go(cfg.Api.Queue.InterestsUpdated.Subj, func(ctx context.Context) (err error) {
+		return consumeQueue(
+			ctx,
 			svc,
 			svcQueue,
 			cfg.Api.Queue.InterestsUpdated.Name,
 			cfg.Api.Queue.InterestsUpdated.Subj,
 			cfg.Api.Queue.InterestsUpdated.BatchSize,
-			func(ctx context.Context, svc service.Service, evts []*pb.CloudEvent) {
-				consumeInterestEvents(ctx, svc, evts, cfg, log)
+			func(ctx context.Context, svc service.Service, evts []*pb.CloudEvent) (n uint32, err error) {
+				return consumeInterestEvents(ctx, svc, evts, interestUpdated, cfg, att, log)
 			},
 		)
-		if err != nil {
-			panic(err)
-		}
-	}()
-
-	err = svcQueue.SetConsumer(context.TODO(), cfg.Api.Queue.SourceSse.Name, cfg.Api.Queue.SourceSse.Subj)
-	if err != nil {
-		panic(err)
-	}
-	log.Info(fmt.Sprintf("initialized the %s queue", cfg.Api.Queue.SourceSse.Name))
-	go func() {
-		err = consumeQueue(
-			context.Background(),
+	})
+	sv.Go(cfg.Api.Queue.InterestsDeleted.Subj, func(ctx context.Context) (err error) {
+		return consumeQueue(
+			ctx,
 			svc,
 			svcQueue,
-			cfg.Api.Queue.SourceSse.Name,
-			cfg.Api.Queue.SourceSse.Subj,
-			cfg.Api.Queue.SourceSse.BatchSize,
-			func(ctx context.Context, svc service.Service, evts []*pb.CloudEvent) {
-				svc.HandleLiveStreamEvents(ctx, evts)
+			cfg.Api.Queue.InterestsDeleted.Name,
+			cfg.Api.Queue.InterestsDeleted.Subj,
+			cfg.Api.Queue.InterestsDeleted.BatchSize,
+			func(ctx context.Context, svc service.Service, evts []*pb.CloudEvent) (n uint32, err error) {
+				return consumeInterestEvents(ctx, svc, evts, interestDeleted, cfg, att, log)
 			},
 		)
-		if err != nil {
-			panic(err)
+	})
+	if cfg.Api.Queue.SourceSse.Enabled {
+		sv.Go(cfg.Api.Queue.SourceSse.Subj, func(ctx context.Context) (err error) {
+			return consumeQueue(
+				ctx,
+				svc,
+				svcQueue,
+				cfg.Api.Queue.SourceSse.Name,
+				cfg.Api.Queue.SourceSse.Subj,
+				cfg.Api.Queue.SourceSse.BatchSize,
+				func(ctx context.Context, svc service.Service, evts []*pb.CloudEvent) (n uint32, err error) {
+					return svc.HandleLiveStreamEvents(ctx, evts)
+				},
+			)
+		})
+	}
+
+	if cfg.Api.Mastodon.Stream.Enabled {
+		svcStream := stream.NewService(
+			clientHttp,
+			cfg.Api.Mastodon.Client.UserAgent,
+			cfg.Api.Mastodon.Endpoint.Protocol,
+			cfg.Api.Mastodon.Endpoint.Streaming,
+			cfg.Api.Mastodon.Stream.Batch.Size,
+			cfg.Api.Mastodon.Stream.Batch.Timeout,
+		)
+		svcStream = stream.NewLogging(svcStream, log)
+		for i, host := range cfg.Api.Mastodon.Client.Hosts {
+			for _, name := range cfg.Api.Mastodon.Stream.Names {
+				token := cfg.Api.Mastodon.Client.Tokens[i]
+				sv.Go(fmt.Sprintf("stream %s@%s", name, host), func(ctx context.Context) (err error) {
+					return consumeStream(ctx, svc, svcStream, host, token, name, cfg.Api.Mastodon)
+				})
+			}
 		}
-	}()
+		log.Info(fmt.Sprintf("started consuming the streams %+v from the hosts %+v", cfg.Api.Mastodon.Stream.Names, cfg.Api.Mastodon.Client.Hosts))
+	}
+
+	if cfg.Api.Mastodon.Tags.Enabled {
+		sv.Go("tags", func(ctx context.Context) (err error) {
+			return pollTags(ctx, svc, cfg.Api.Mastodon.Tags.Interval)
+		})
+		log.Info(fmt.Sprintf("started polling the hashtag timelines every %s", cfg.Api.Mastodon.Tags.Interval))
+	}
 
 	log.Info(fmt.Sprintf("starting to listen the gRPC API @ port #%d...", cfg.Api.Port))
-	err = apiGrpc.Serve(cfg.Api.Port, svc)
+	sv.Go("grpc", func(ctx context.Context) (err error) {
+		return apiGrpc.Serve(ctx, cfg.Api.Port, cfg.Shutdown.DrainDelay, svc)
+	})
+
+	<-ctx.Done()
+	// restore the default signal handling, so the repeated signal terminates immediately
+	stop()
+	log.Info(fmt.Sprintf("shutting down, waiting up to %s for the in-flight batches...", cfg.Shutdown.Timeout))
+	err = sv.Wait(cfg.Shutdown.Timeout)
 	if err != nil {
-		panic(err)
+		log.Error(fmt.Sprintf("shutdown: %s", err))
+		os.Exit(1)
 	}
+	log.Info("shutdown complete")
 }
 
 func consumeQueue(
@@ -142,15 +245,63 @@ func consumeQueue(
 	svcQueue queue.Service,
 	name, subj string,
 	batchSize uint32,
-	consumeEvents func(ctx context.Context, svc service.Service, evts []*pb.CloudEvent),
+	consumeEvents func(ctx context.Context, svc service.Service, evts []*pb.CloudEvent) (n uint32, err error),
 ) (err error) {
+	err = svcQueue.SetConsumer(ctx, name, subj)
+	if err == nil {
+		// the received batch is processed till the end even when shutting down
+		ctxProc := context.WithoutCancel(ctx)
+		err = svcQueue.ReceiveMessages(ctx, name, subj, batchSize, func(evts []*pb.CloudEvent) (n uint32, err error) {
+			return consumeEvents(ctxProc, svc, evts)
+		})
+	}
+	return
+}
+
+func consumeStream(
+	ctx context.Context,
+	svc service.Service,
+	svcStream stream.Service,
+	host, token, name string,
+	cfg config.MastodonConfig,
+) (err error) {
+	// the received batch is processed till the end even when shutting down
+	ctxProc := context.WithoutCancel(ctx)
+	var lastEvtId string
+	backoff := cfg.Stream.Backoff.Min
 	for {
-		err = svcQueue.ReceiveMessages(ctx, name, subj, batchSize, func(evts []*pb.CloudEvent) (err error) {
-			consumeEvents(ctx, svc, evts)
+		var received bool
+		lastEvtId, _ = svcStream.Consume(ctx, host, token, name, lastEvtId, func(evts []*pb.CloudEvent) (err error) {
+			received = true
+			// no redelivery from the stream, the failures are logged by the service
+			_, _ = svc.HandleLiveStreamEvents(ctxProc, evts)
 			return
 		})
-		if err != nil {
-			panic(err)
+		if received {
+			backoff = cfg.Stream.Backoff.Min
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > cfg.Stream.Backoff.Max {
+			backoff = cfg.Stream.Backoff.Max
+		}
+	}
+}
+
+func pollTags(ctx context.Context, svc service.Service, interval time.Duration) (err error) {
+	// the started poll is completed even when shutting down
+	ctxProc := context.WithoutCancel(ctx)
+	for {
+		// the failures are logged by the service, the failed statuses are fetched again on the next poll
+		_, _ = svc.PollTags(ctxProc)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
 		}
 	}
 }
@@ -159,44 +310,122 @@ func consumeInterestEvents(
 	ctx context.Context,
 	svc service.Service,
 	evts []*pb.CloudEvent,
+	op interestOp,
 	cfg config.Config,
+	att *attempts,
 	log *slog.Logger,
-) {
-	log.Debug(fmt.Sprintf("consumeInterestEvents(%d))\n", len(evts)))
+) (n uint32, err error) {
+	log.Debug(fmt.Sprintf("consumeInterestEvents(%d, %d))\n", len(evts), op))
 	for _, evt := range evts {
-
-		interestId := evt.GetTextData()
-		var groupId string
-		if groupIdAttr, groupIdIdPresent := evt.Attributes[ceKeyGroupId]; groupIdIdPresent {
-			groupId = groupIdAttr.GetCeString()
-		}
-		if groupId == "" {
-			log.Error(fmt.Sprintf("interest %s event: empty group id, skipping", interestId))
-			continue
+		err = consumeInterestEvent(ctx, svc, evt, op, cfg, log)
+		if err != nil {
+			count := att.fail(evt.Id)
+			switch {
+			case service.Permanent(err):
+				log.Error(fmt.Sprintf("interest %s event %s: permanent failure, skipping: %s", evt.GetTextData(), evt.Id, err))
+			case count >= cfg.Api.Queue.AttemptsMax:
+				log.Error(fmt.Sprintf("interest %s event %s: failed %d times, skipping: %s", evt.GetTextData(), evt.Id, count, err))
+			default:
+				// stop here, the rest of the batch will be redelivered
+				return
+			}
+			err = nil
 		}
+		att.done(evt.Id)
+		n++
+	}
+	return
+}
 
-		publicAttr, publicAttrPresent := evt.Attributes[ceKeyPublic]
-		switch publicAttrPresent && publicAttr.GetCeBoolean() {
-		case true:
-			actor := interestId + "@" + cfg.Api.ActivityPub.Host
-			_, _ = svc.SearchAndAdd(ctx, interestId, groupId, actor, 1, model.SearchTypeAccounts)
-		default:
-			log.Debug(fmt.Sprintf("interest %s event: public: %t/%t", interestId, publicAttrPresent, publicAttr.GetCeBoolean()))
-		}
+func consumeInterestEvent(
+	ctx context.Context,
+	svc service.Service,
+	evt *pb.CloudEvent,
+	op interestOp,
+	cfg config.Config,
+	log *slog.Logger,
+) (err error) {
+
+	interestId := evt.GetTextData()
+	var groupId string
+	if groupIdAttr, groupIdIdPresent := evt.Attributes[ceKeyGroupId]; groupIdIdPresent {
+		groupId = groupIdAttr.GetCeString()
+	}
+	if groupId == "" {
+		log.Error(fmt.Sprintf("interest %s event: empty group id, skipping", interestId))
+		return
+	}
 
-		var discover bool
-		if attrDiscover, attrDiscoverExists := evt.Attributes[ceKeyDiscover]; attrDiscoverExists {
-			discover = attrDiscover.GetCeBoolean()
+	actor := interestId + "@" + cfg.Api.ActivityPub.Host
+	if op == interestDeleted {
+		_, err = svc.RemoveSources(ctx, interestId, groupId, actor, model.SearchTypeAccounts)
+		_, errRemove := svc.RemoveSources(ctx, interestId, groupId, "", model.SearchTypeStatuses)
+		err = errors.Join(err, errRemove)
+		if cfg.Api.Mastodon.Tags.Enabled {
+			_, errTags := svc.FollowTags(ctx, interestId, nil)
+			err = errors.Join(err, errTags)
 		}
-		var queries []string
-		if queriesComplAttr, queriesComplPresent := evt.Attributes[ceKeyQueriesCompl]; queriesComplPresent {
-			queries = strings.Split(queriesComplAttr.GetCeString(), "\n")
+		return
+	}
+
+	publicAttr, publicAttrPresent := evt.Attributes[ceKeyPublic]
+	switch {
+	case publicAttrPresent && publicAttr.GetCeBoolean():
+		_, err = svc.SearchAndAdd(ctx, interestId, groupId, actor, 1, model.SearchTypeAccounts)
+	case op == interestUpdated:
+		// may be switched to non-public
+		_, err = svc.RemoveSources(ctx, interestId, groupId, actor, model.SearchTypeAccounts)
+	default:
+		log.Debug(fmt.Sprintf("interest %s event: public: %t/%t", interestId, publicAttrPresent, publicAttr.GetCeBoolean()))
+	}
+
+	var discover bool
+	if attrDiscover, attrDiscoverExists := evt.Attributes[ceKeyDiscover]; attrDiscoverExists {
+		discover = attrDiscover.GetCeBoolean()
+	}
+	var queries []string
+	if queriesComplAttr, queriesComplPresent := evt.Attributes[ceKeyQueriesCompl]; queriesComplPresent {
+		queries = strings.Split(queriesComplAttr.GetCeString(), "\n")
+	}
+	if discover && len(queries) > 0 {
+		for _, q := range queries {
+			_, errSearch := svc.SearchAndAdd(ctx, interestId, groupId, q, cfg.Api.Mastodon.Search.Limit, model.SearchTypeStatuses)
+			err = errors.Join(err, errSearch)
 		}
-		if discover && len(queries) > 0 {
-			for _, q := range queries {
-				_, _ = svc.SearchAndAdd(ctx, interestId, groupId, q, cfg.Api.Mastodon.Search.Limit, model.SearchTypeStatuses)
-			}
+	}
+	if cfg.Api.Mastodon.Tags.Enabled {
+		// may be switched to non-discoverable
+		if !discover {
+			queries = nil
 		}
+		_, errTags := svc.FollowTags(ctx, interestId, queries)
+		err = errors.Join(err, errTags)
+	}
+	return
+}
+
+// attempts counts the failed attempts to consume the queued events by the event id.
+type attempts struct {
+	lock   sync.Mutex
+	counts map[string]uint32
+}
+
+func newAttempts() *attempts {
+	return &attempts{
+		counts: make(map[string]uint32),
 	}
+}
+
+func (a *attempts) fail(id string) (count uint32) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	count = a.counts[id] + 1
+	a.counts[id] = count
 	return
 }
+
+func (a *attempts) done(id string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.counts, id)
+}
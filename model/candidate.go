@@ -0,0 +1,10 @@
+package model
+
+// Candidate is the account found by the search with the decision whether it would be added.
+type Candidate struct {
+	AccountUri string
+	// StatusUri is set only when searching the statuses
+	StatusUri string
+	Host      string
+	Decision  Decision
+}
@@ -0,0 +1,24 @@
+package model
+
+// Cursor is the id of the newest status fetched on the host for the key, e.g. the interest's search query, so the
+// next fetch may skip the older statuses.
+type Cursor struct {
+	Host string `json:"host"`
+	Key  string `json:"key"`
+	Id   string `json:"id"`
+}
+
+// IdNewer returns true if the status id a is newer than b. Mastodon ids are the numbers growing with the time, but
+// the ids of the different lengths are not comparable as strings.
+func IdNewer(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a > b
+}
+
+// InterestTags are the hashtags followed for the interest.
+type InterestTags struct {
+	InterestId string   `json:"interestId"`
+	Tags       []string `json:"tags"`
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIdNewer(t *testing.T) {
+	cases := map[string]struct {
+		a, b  string
+		newer bool
+	}{
+		"same length": {
+			a:     "113456789012345679",
+			b:     "113456789012345678",
+			newer: true,
+		},
+		"longer": {
+			a:     "10",
+			b:     "9",
+			newer: true,
+		},
+		"shorter": {
+			a: "9",
+			b: "10",
+		},
+		"equal": {
+			a: "9",
+			b: "9",
+		},
+		"empty": {
+			a:     "1",
+			newer: true,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.newer, IdNewer(c.a, c.b))
+		})
+	}
+}
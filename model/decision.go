@@ -0,0 +1,84 @@
+package model
+
+import "fmt"
+
+// Decision tells whether the found status or account is accepted and why it's rejected otherwise.
+type Decision struct {
+	Accepted bool   `json:"accepted"`
+	Reason   Reason `json:"reason,omitempty"`
+	// Detail is the human-readable explanation, e.g. the value failed to satisfy the condition
+	Detail string `json:"detail,omitempty"`
+}
+
+type Reason int
+
+const (
+	ReasonNone Reason = iota
+	ReasonSensitive
+	ReasonLowFollowers
+	ReasonLowPosts
+	ReasonNotDiscoverable
+	ReasonNotIndexable
+	ReasonNoindex
+	ReasonOptOut
+	ReasonNotPublic
+	ReasonInstanceBlocked
+	ReasonInstanceNotAllowed
+	ReasonRobots
+	ReasonNodeInfo
+	ReasonReblog
+	ReasonReply
+	ReasonQuote
+)
+
+var reasonNames = []string{
+	"",
+	"sensitive",
+	"low_followers",
+	"low_posts",
+	"not_discoverable",
+	"not_indexable",
+	"noindex",
+	"opt_out",
+	"not_public",
+	"instance_blocked",
+	"instance_not_allowed",
+	"robots",
+	"nodeinfo",
+	"reblog",
+	"reply",
+	"quote",
+}
+
+func (r Reason) String() string {
+	if r >= 0 && int(r) < len(reasonNames) {
+		return reasonNames[r]
+	}
+	return fmt.Sprintf("unknown(%d)", int(r))
+}
+
+func Accept() Decision {
+	return Decision{
+		Accepted: true,
+	}
+}
+
+func Reject(reason Reason, detail string) Decision {
+	return Decision{
+		Reason: reason,
+		Detail: detail,
+	}
+}
+
+func (d Decision) String() (s string) {
+	switch d.Accepted {
+	case true:
+		s = "accepted"
+	default:
+		s = "rejected: " + d.Reason.String()
+		if d.Detail != "" {
+			s += ": " + d.Detail
+		}
+	}
+	return
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDecision_String(t *testing.T) {
+	cases := map[string]struct {
+		d        Decision
+		expected string
+	}{
+		"accepted": {
+			d:        Accept(),
+			expected: "accepted",
+		},
+		"rejected": {
+			d:        Reject(ReasonLowFollowers, "followers count 1 < 10"),
+			expected: "rejected: low_followers: followers count 1 < 10",
+		},
+		"rejected w/o detail": {
+			d:        Reject(ReasonOptOut, ""),
+			expected: "rejected: opt_out",
+		},
+		"unknown reason": {
+			d:        Reject(Reason(100), ""),
+			expected: "rejected: unknown(100)",
+		},
+		"negative reason": {
+			d:        Reject(Reason(-1), ""),
+			expected: "rejected: unknown(-1)",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.expected, c.d.String())
+		})
+	}
+}
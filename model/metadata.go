@@ -1,12 +1,69 @@
 package model
 
+import "strconv"
+
 const CeSpecVersion = "1.0"
 const CeKeyAttachmentUrl = "attachmenturl"
 const CeKeyAttachmentType = "attachmenttype"
+const CeKeyAttachmentDescription = "attachmentdesc"
+const CeKeyAttachmentSensitive = "attachmentsensitive"
+const CeKeyAttachmentCount = "attachmentcount"
 const CeKeyCategories = "categories"
+const CeKeyContentHtml = "contenthtml"
+const CeKeyContentWarning = "contentwarning"
+const CeKeyConversation = "conversation"
+const CeKeyBoostedBy = "boostedby"
+const CeKeyCardDescription = "carddescription"
+const CeKeyCardImage = "cardimage"
+const CeKeyCardProvider = "cardprovider"
+const CeKeyCardTitle = "cardtitle"
+const CeKeyCardUrl = "cardurl"
+const CeKeyInReplyTo = "inreplyto"
+const CeKeyInReplyToAccount = "inreplytoaccount"
+const CeKeyObject = "object"
 const CeKeyObjectUrl = "objecturl"
+const CeKeyPollExpires = "pollexpires"
+const CeKeyPollMultiple = "pollmultiple"
+const CeKeyPollVotes = "pollvotes"
+const CeKeyQuote = "quote"
+const CeKeyRevision = "revision"
+const CeKeySensitive = "sensitive"
 const CeKeySubject = "subject"
 const CeKeyTime = "time"
 
+// CeKeyLenMax is the max length of the attribute name, the longer ones may be rejected by the CloudEvents SDKs.
+const CeKeyLenMax = 20
+
 const KeyGroupId = "x-awakari-group-id"
 const KeyUserId = "x-awakari-user-id"
+
+// The fields of every attachment, see CeKeyAttachment.
+const (
+	CeAttachmentType        = "type"
+	CeAttachmentUrl         = "url"
+	CeAttachmentPreviewUrl  = "previewurl"
+	CeAttachmentRemoteUrl   = "remoteurl"
+	CeAttachmentDescription = "description"
+	CeAttachmentWidth       = "width"
+	CeAttachmentHeight      = "height"
+	CeAttachmentDuration    = "duration"
+	CeAttachmentBlurhash    = "blurhash"
+)
+
+// CeKeyAttachment returns the attribute key of the attachment field by the zero-based attachment index,
+// e.g. "att0url". The attribute names allow only the lowercase letters and digits, and should be not longer than
+// CeKeyLenMax, hence the short prefix.
+func CeKeyAttachment(i int, field string) string {
+	return "att" + strconv.Itoa(i) + field
+}
+
+// CeKeyPollOption returns the attribute key of the poll option title by the zero-based option index,
+// e.g. "polloption0".
+func CeKeyPollOption(i int) string {
+	return "polloption" + strconv.Itoa(i)
+}
+
+// CeKeyPollOptionVotes returns the attribute key of the poll option votes count, e.g. "polloption0votes".
+func CeKeyPollOptionVotes(i int) string {
+	return CeKeyPollOption(i) + "votes"
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCeKeyAttachment(t *testing.T) {
+	for _, field := range []string{
+		CeAttachmentType,
+		CeAttachmentUrl,
+		CeAttachmentPreviewUrl,
+		CeAttachmentRemoteUrl,
+		CeAttachmentDescription,
+		CeAttachmentWidth,
+		CeAttachmentHeight,
+		CeAttachmentDuration,
+		CeAttachmentBlurhash,
+	} {
+		k := CeKeyAttachment(999, field)
+		assert.LessOrEqual(t, len(k), CeKeyLenMax, k)
+	}
+	assert.Equal(t, "att0previewurl", CeKeyAttachment(0, CeAttachmentPreviewUrl))
+}
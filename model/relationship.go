@@ -0,0 +1,12 @@
+package model
+
+// Relationship is the account relationship to the authenticated user.
+type Relationship struct {
+	Id         string `json:"id"`
+	Following  bool   `json:"following"`
+	Requested  bool   `json:"requested"` // the follow request is pending for the locked account
+	FollowedBy bool   `json:"followed_by"`
+	Blocking   bool   `json:"blocking"`
+	BlockedBy  bool   `json:"blocked_by"`
+	Muting     bool   `json:"muting"`
+}
@@ -8,32 +8,75 @@ type Results struct {
 }
 
 type Status struct {
-	CreatedAt        time.Time         `json:"created_at"`
-	Visibility       string            `json:"visibility"`
-	Language         string            `json:"language,omitempty"`
-	Uri              string            `json:"uri,omitempty"`
-	Url              string            `json:"url,omitempty"`
-	Content          string            `json:"content"`
-	Sensitive        bool              `json:"sensitive"`
-	Account          Account           `json:"account"`
-	Tags             []Tag             `json:"tags"`
-	MediaAttachments []MediaAttachment `json:"media_attachments"`
+	Id                 string            `json:"id"`
+	CreatedAt          time.Time         `json:"created_at"`
+	EditedAt           *time.Time        `json:"edited_at,omitempty"`
+	Visibility         string            `json:"visibility"`
+	Language           string            `json:"language,omitempty"`
+	Uri                string            `json:"uri,omitempty"`
+	Url                string            `json:"url,omitempty"`
+	Content            string            `json:"content"`
+	Sensitive          bool              `json:"sensitive"`    // the media is sensitive too
+	SpoilerText        string            `json:"spoiler_text"` // content warning
+	Account            Account           `json:"account"`
+	Tags               []Tag             `json:"tags"`
+	MediaAttachments   []MediaAttachment `json:"media_attachments"`
+	Mentions           []Mention         `json:"mentions"`
+	InReplyToId        string            `json:"in_reply_to_id,omitempty"`         // local to the host the status is received from
+	InReplyToAccountId string            `json:"in_reply_to_account_id,omitempty"` // local to the host the status is received from
+	Reblog             *Status           `json:"reblog,omitempty"`                 // the boosted status, the content of the boost itself is empty
+	Quote              *Quote            `json:"quote,omitempty"`
+	Poll               *Poll             `json:"poll,omitempty"`
+	Card               *Card             `json:"card,omitempty"`
+	Emojis             []CustomEmoji     `json:"emojis"`
+}
+
+type Mention struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+	Acct     string `json:"acct"` // the username only for the local account
+	Url      string `json:"url"`
+}
+
+// Quote is the quoted status, present only when the quote is accepted by the quoted author.
+type Quote struct {
+	State        string  `json:"state"`
+	QuotedStatus *Status `json:"quoted_status,omitempty"`
+}
+
+const QuoteStateAccepted = "accepted"
+
+// Quoted returns the quoted status if the quote may be shown.
+func (q *Quote) Quoted() (st *Status) {
+	if q != nil && (q.State == "" || q.State == QuoteStateAccepted) {
+		st = q.QuotedStatus
+	}
+	return
 }
 
 type Account struct {
-	Id             string `json:"id"`
-	Acct           string `json:"acct"`
-	Discoverable   bool   `json:"discoverable"`
-	DisplayName    string `json:"display_name"`
-	Indexable      *bool  `json:"indexable,omitempty"` // sometimes it's missing
-	Locked         bool   `json:"locked"`
-	Noindex        bool   `json:"noindex"`
-	Note           string `json:"note"`
-	Uri            string `json:"uri"`
-	Url            string `json:"url"`
-	FollowersCount uint32 `json:"followers_count"`
-	StatusesCount  uint32 `json:"statuses_count"`
-	Tags           []Tag  `json:"tags"`
+	Id             string        `json:"id"`
+	Acct           string        `json:"acct"`
+	Discoverable   bool          `json:"discoverable"`
+	DisplayName    string        `json:"display_name"`
+	Indexable      *bool         `json:"indexable,omitempty"` // sometimes it's missing
+	Locked         bool          `json:"locked"`
+	Noindex        bool          `json:"noindex"`
+	Note           string        `json:"note"`
+	Uri            string        `json:"uri"`
+	Url            string        `json:"url"`
+	FollowersCount uint32        `json:"followers_count"`
+	StatusesCount  uint32        `json:"statuses_count"`
+	Tags           []Tag         `json:"tags"`
+	Fields         []Field       `json:"fields"`
+	Emojis         []CustomEmoji `json:"emojis"` // used in the display name, bio and fields
+}
+
+// Field is the profile metadata entry, the value may contain HTML.
+type Field struct {
+	Name       string     `json:"name"`
+	Value      string     `json:"value"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
 }
 
 type Tag struct {
@@ -41,7 +84,54 @@ type Tag struct {
 }
 
 type MediaAttachment struct {
-	Type       string `json:"type"`
-	Url        string `json:"url"`
-	PreviewUrl string `json:"preview_url"`
+	Type        string    `json:"type"`
+	Url         string    `json:"url"`
+	PreviewUrl  string    `json:"preview_url"`
+	RemoteUrl   string    `json:"remote_url"`
+	Description string    `json:"description"` // alt text
+	Blurhash    string    `json:"blurhash"`
+	Meta        MediaMeta `json:"meta"`
+}
+
+// MediaMeta describes the original file and its small preview, any of them may be missing.
+type MediaMeta struct {
+	Original MediaDimensions `json:"original"`
+	Small    MediaDimensions `json:"small"`
+}
+
+type MediaDimensions struct {
+	Width    uint32  `json:"width"`
+	Height   uint32  `json:"height"`
+	Duration float64 `json:"duration"` // seconds, audio and video only
+}
+
+type Poll struct {
+	ExpiresAt  *time.Time    `json:"expires_at,omitempty"` // never expires when missing
+	Expired    bool          `json:"expired"`
+	Multiple   bool          `json:"multiple"`
+	VotesCount uint32        `json:"votes_count"`
+	Options    []PollOption  `json:"options"`
+	Emojis     []CustomEmoji `json:"emojis"`
+}
+
+type PollOption struct {
+	Title      string  `json:"title"`
+	VotesCount *uint32 `json:"votes_count,omitempty"` // hidden until the poll ends, if the author wishes so
+}
+
+// Card is the link preview.
+type Card struct {
+	Url          string `json:"url"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Type         string `json:"type"`
+	ProviderName string `json:"provider_name"`
+	Image        string `json:"image,omitempty"`
+}
+
+// CustomEmoji is the image the ":shortcode:" text is displayed as.
+type CustomEmoji struct {
+	Shortcode string `json:"shortcode"`
+	Url       string `json:"url"`
+	StaticUrl string `json:"static_url"`
 }
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Source is the decision made about the account found for the interest.
+type Source struct {
+	AccountUri string        `json:"accountUri"`
+	Host       string        `json:"host"`
+	InterestId string        `json:"interestId"`
+	GroupId    string        `json:"groupId"`
+	Query      string        `json:"query"`
+	Time       time.Time     `json:"time"`
+	Outcome    SourceOutcome `json:"outcome"`
+	Decision   Decision      `json:"decision"`
+	// Error is set when the outcome is failed
+	Error string `json:"error,omitempty"`
+}
+
+// SourceFilter selects the sources, the empty fields match any value.
+type SourceFilter struct {
+	AccountUri string `json:"accountUri,omitempty"`
+	Host       string `json:"host,omitempty"`
+	InterestId string `json:"interestId,omitempty"`
+}
+
+type SourceOutcome int
+
+const (
+	SourceOutcomeRejected SourceOutcome = iota
+	SourceOutcomeFailed
+	// SourceOutcomeFollowed means the account is followed directly by the Mastodon client account on the host.
+	SourceOutcomeFollowed
+	// SourceOutcomeDelegated means the account follow is delegated to int-activitypub.
+	SourceOutcomeDelegated
+)
+
+var sourceOutcomeNames = []string{
+	"rejected",
+	"failed",
+	"followed",
+	"delegated",
+}
+
+func (o SourceOutcome) String() string {
+	if o >= 0 && int(o) < len(sourceOutcomeNames) {
+		return sourceOutcomeNames[o]
+	}
+	return fmt.Sprintf("unknown(%d)", int(o))
+}
+
+// Added returns true if the account is followed, directly or via int-activitypub.
+func (o SourceOutcome) Added() bool {
+	return o == SourceOutcomeFollowed || o == SourceOutcomeDelegated
+}
+
+func (f SourceFilter) Match(src Source) bool {
+	return (f.AccountUri == "" || f.AccountUri == src.AccountUri) &&
+		(f.Host == "" || f.Host == src.Host) &&
+		(f.InterestId == "" || f.InterestId == src.InterestId)
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSourceOutcome_String(t *testing.T) {
+	cases := map[string]struct {
+		o        SourceOutcome
+		expected string
+	}{
+		"delegated": {
+			o:        SourceOutcomeDelegated,
+			expected: "delegated",
+		},
+		"unknown": {
+			o:        SourceOutcome(42),
+			expected: "unknown(42)",
+		},
+		"negative": {
+			o:        SourceOutcome(-1),
+			expected: "unknown(-1)",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.expected, c.o.String())
+		})
+	}
+}
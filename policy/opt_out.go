@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/awakari/int-mastodon/content"
+	"github.com/awakari/int-mastodon/model"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// optOut rejects when any of the opt-out markers is found. The marker starting with "#" is the hashtag, matched
+// against the hashtags and as the whole word in the account bio and profile fields. Other markers are the phrases
+// (or emojis) matched as the case-insensitive substrings of the bio and profile fields.
+type optOut struct {
+	tags    []string
+	phrases []string
+}
+
+func OptOut(markers ...string) Policy {
+	var oo optOut
+	for _, m := range markers {
+		m = strings.ToLower(strings.TrimSpace(m))
+		switch {
+		case m == "" || m == "#":
+		case strings.HasPrefix(m, "#"):
+			oo.tags = append(oo.tags, m[1:])
+		default:
+			oo.phrases = append(oo.phrases, m)
+		}
+	}
+	return oo
+}
+
+func (oo optOut) Status(st model.Status) (d model.Decision) {
+	d = oo.checkTags(st.Tags, "status")
+	if d.Accepted {
+		d = oo.Account(st.Account)
+	}
+	return
+}
+
+func (oo optOut) Account(acc model.Account) (d model.Decision) {
+	d = oo.checkTags(acc.Tags, "account")
+	if d.Accepted {
+		d = oo.checkText(content.Text(acc.Note), "bio")
+	}
+	for _, f := range acc.Fields {
+		if !d.Accepted {
+			break
+		}
+		d = oo.checkText(content.Text(f.Name)+" "+content.Text(f.Value), fmt.Sprintf("profile field %q", f.Name))
+	}
+	return
+}
+
+func (oo optOut) checkTags(tags []model.Tag, subj string) (d model.Decision) {
+	d = model.Accept()
+	for _, t := range tags {
+		name := strings.ToLower(strings.TrimPrefix(t.Name, "#"))
+		for _, tag := range oo.tags {
+			if name == tag {
+				return model.Reject(model.ReasonOptOut, fmt.Sprintf("%s has the #%s tag", subj, tag))
+			}
+		}
+	}
+	return
+}
+
+func (oo optOut) checkText(txt, subj string) (d model.Decision) {
+	d = model.Accept()
+	txt = strings.ToLower(txt)
+	for _, tag := range oo.tags {
+		if containsHashtag(txt, tag) {
+			return model.Reject(model.ReasonOptOut, fmt.Sprintf("%s contains #%s", subj, tag))
+		}
+	}
+	for _, phrase := range oo.phrases {
+		if strings.Contains(txt, phrase) {
+			return model.Reject(model.ReasonOptOut, fmt.Sprintf("%s contains %q", subj, phrase))
+		}
+	}
+	return
+}
+
+// containsHashtag returns true if the text contains the hashtag not followed by another word character,
+// e.g. "#nobot" matches "#nobot." but not "#nobotany".
+func containsHashtag(txt, tag string) bool {
+	marker := "#" + tag
+	for {
+		i := strings.Index(txt, marker)
+		if i < 0 {
+			return false
+		}
+		txt = txt[i+len(marker):]
+		next, _ := utf8.DecodeRuneInString(txt)
+		if txt == "" || !(unicode.IsLetter(next) || unicode.IsDigit(next) || next == '_') {
+			return true
+		}
+	}
+}
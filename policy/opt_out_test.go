@@ -0,0 +1,124 @@
+package policy
+
+import (
+	"github.com/awakari/int-mastodon/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOptOut(t *testing.T) {
+	p := OptOut("#nobot", "#NoBots", "#nosearch", "#noindex", "#noarchive", "🚫🤖", "No Bots Please", " ", "#")
+	cases := map[string]struct {
+		st     model.Status
+		detail string
+	}{
+		"no markers": {
+			st: model.Status{
+				Tags: []model.Tag{{Name: "mastodon"}},
+				Account: model.Account{
+					Note: `<p>Hello, I like #<span>botany</span> and bots</p>`,
+					Fields: []model.Field{
+						{Name: "Website", Value: `<a href="https://example.com">example.com</a>`},
+					},
+				},
+			},
+		},
+		"#nobot status tag": {
+			st: model.Status{
+				Tags: []model.Tag{{Name: "NoBot"}},
+			},
+			detail: "status has the #nobot tag",
+		},
+		"#nobots account tag": {
+			st: model.Status{
+				Account: model.Account{
+					Tags: []model.Tag{{Name: "#nobots"}},
+				},
+			},
+			detail: "account has the #nobots tag",
+		},
+		"#nosearch in bio": {
+			st: model.Status{
+				Account: model.Account{
+					Note: `<p>Hello <a href="https://host1/tags/nosearch" class="mention hashtag" rel="tag">#<span>NoSearch</span></a></p>`,
+				},
+			},
+			detail: "bio contains #nosearch",
+		},
+		"#noindex in bio at the end": {
+			st: model.Status{
+				Account: model.Account{
+					Note: `hello #noindex`,
+				},
+			},
+			detail: "bio contains #noindex",
+		},
+		"#noarchive in bio followed by punctuation": {
+			st: model.Status{
+				Account: model.Account{
+					Note: `<p>#noarchive, thanks</p>`,
+				},
+			},
+			detail: "bio contains #noarchive",
+		},
+		"hashtag prefix in bio is not the marker": {
+			st: model.Status{
+				Account: model.Account{
+					Note: `<p>#nobotany #noindexing</p>`,
+				},
+			},
+		},
+		"emoji in bio": {
+			st: model.Status{
+				Account: model.Account{
+					Note: `<p>Human here 🚫🤖</p>`,
+				},
+			},
+			detail: `bio contains "🚫🤖"`,
+		},
+		"phrase in bio": {
+			st: model.Status{
+				Account: model.Account{
+					Note: `<p>no bots please &amp; thanks</p>`,
+				},
+			},
+			detail: `bio contains "no bots please"`,
+		},
+		"marker in profile field value": {
+			st: model.Status{
+				Account: model.Account{
+					Fields: []model.Field{
+						{Name: "Website", Value: "example.com"},
+						{Name: "Bots", Value: "#NoBot"},
+					},
+				},
+			},
+			detail: `profile field "Bots" contains #nobot`,
+		},
+		"marker in profile field name": {
+			st: model.Status{
+				Account: model.Account{
+					Fields: []model.Field{
+						{Name: "🚫🤖", Value: "yes"},
+					},
+				},
+			},
+			detail: `profile field "🚫🤖" contains "🚫🤖"`,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			d := p.Status(c.st)
+			switch c.detail {
+			case "":
+				assert.Equal(t, model.Accept(), d)
+			default:
+				assert.Equal(t, model.Reject(model.ReasonOptOut, c.detail), d)
+			}
+			// the account check only
+			if c.st.Tags == nil {
+				assert.Equal(t, d, p.Account(c.st.Account))
+			}
+		})
+	}
+}
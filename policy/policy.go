@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/awakari/int-mastodon/config"
+	"github.com/awakari/int-mastodon/model"
+)
+
+// Policy decides whether the found or received content may be consumed.
+type Policy interface {
+
+	// Status decides whether the status may be consumed. The status author's account is checked too.
+	Status(st model.Status) (d model.Decision)
+
+	// Account decides whether the account may be followed.
+	Account(acc model.Account) (d model.Decision)
+}
+
+const (
+	RuleSensitive    = "sensitive"
+	RuleVisibility   = "visibility"
+	RuleDiscoverable = "discoverable"
+	RuleIndexable    = "indexable"
+	RuleNoindex      = "noindex"
+	RuleOptOut       = "optout"
+	RuleFollowers    = "followers"
+	RulePosts        = "posts"
+	RuleReply        = "reply"
+	RuleQuote        = "quote"
+)
+
+const (
+	ReblogPublish = "publish"
+	ReblogFollow  = "follow"
+	ReblogSkip    = "skip"
+)
+
+// RuleNoBot is the deprecated alias of RuleOptOut
+const RuleNoBot = "nobot"
+
+var ErrUnknownRule = errors.New("unknown policy rule")
+var ErrUnknownReblog = errors.New("unknown reblog policy")
+
+// NewPolicy composes the rules enabled by the configuration in the configured order. The boosts are rejected first
+// when skipped, otherwise it's up to the caller to check the boosted status too.
+func NewPolicy(cfg config.MastodonConfig) (p Policy, err error) {
+	var rules []Policy
+	switch cfg.Policy.Reblog {
+	case ReblogPublish, ReblogFollow, "":
+	case ReblogSkip:
+		rules = append(rules, Reblog())
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownReblog, cfg.Policy.Reblog)
+	}
+	for _, name := range cfg.Policy.Rules {
+		switch name {
+		case RuleSensitive:
+			rules = append(rules, Sensitive(cfg.Content.Warning.Publish))
+		case RuleVisibility:
+			rules = append(rules, Visibility(cfg.Policy.Visibility...))
+		case RuleDiscoverable:
+			rules = append(rules, Discoverable())
+		case RuleIndexable:
+			rules = append(rules, Indexable())
+		case RuleNoindex:
+			rules = append(rules, Noindex())
+		case RuleOptOut, RuleNoBot:
+			rules = append(rules, OptOut(cfg.Policy.OptOut...))
+		case RuleFollowers:
+			rules = append(rules, FollowersMin(cfg.CountMin.Followers))
+		case RulePosts:
+			rules = append(rules, PostsMin(cfg.CountMin.Posts))
+		case RuleReply:
+			rules = append(rules, Reply())
+		case RuleQuote:
+			rules = append(rules, Quote())
+		default:
+			err = errors.Join(err, fmt.Errorf("%w: %s", ErrUnknownRule, name))
+		}
+	}
+	if err == nil {
+		p = All(rules...)
+	}
+	return
+}
+
+type all []Policy
+
+// All accepts only when every of the specified policies accepts. The first rejection wins.
+func All(policies ...Policy) Policy {
+	return all(policies)
+}
+
+func (a all) Status(st model.Status) (d model.Decision) {
+	d = model.Accept()
+	for _, p := range a {
+		d = p.Status(st)
+		if !d.Accepted {
+			break
+		}
+	}
+	return
+}
+
+func (a all) Account(acc model.Account) (d model.Decision) {
+	d = model.Accept()
+	for _, p := range a {
+		d = p.Account(acc)
+		if !d.Accepted {
+			break
+		}
+	}
+	return
+}
+
+// statusRule checks the status only, any account is accepted.
+type statusRule func(st model.Status) model.Decision
+
+func (r statusRule) Status(st model.Status) model.Decision {
+	return r(st)
+}
+
+func (r statusRule) Account(acc model.Account) model.Decision {
+	return model.Accept()
+}
+
+// accountRule checks the account, either found or the status author.
+type accountRule func(acc model.Account) model.Decision
+
+func (r accountRule) Status(st model.Status) model.Decision {
+	return r(st.Account)
+}
+
+func (r accountRule) Account(acc model.Account) model.Decision {
+	return r(acc)
+}
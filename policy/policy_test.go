@@ -0,0 +1,304 @@
+package policy
+
+import (
+	"github.com/awakari/int-mastodon/config"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newTestPolicy(t *testing.T) Policy {
+	cfg := config.MastodonConfig{}
+	cfg.Policy.Rules = []string{
+		RuleSensitive,
+		RuleVisibility,
+		RuleDiscoverable,
+		RuleIndexable,
+		RuleNoindex,
+		RuleOptOut,
+		RuleFollowers,
+		RulePosts,
+	}
+	cfg.Policy.Visibility = []string{"public", "unlisted"}
+	cfg.Policy.OptOut = []string{"#nobot"}
+	cfg.CountMin.Followers = 10
+	cfg.CountMin.Posts = 100
+	p, err := NewPolicy(cfg)
+	assert.NoError(t, err)
+	return p
+}
+
+func TestPolicy_Status(t *testing.T) {
+	p := newTestPolicy(t)
+	indexable := false
+	acc := model.Account{
+		Discoverable:   true,
+		FollowersCount: 10,
+		StatusesCount:  100,
+	}
+	cases := map[string]struct {
+		st     func(st *model.Status)
+		reason model.Reason
+	}{
+		"accepted": {},
+		"unlisted": {
+			st: func(st *model.Status) {
+				st.Visibility = "unlisted"
+			},
+		},
+		"sensitive": {
+			st: func(st *model.Status) {
+				st.Sensitive = true
+			},
+			reason: model.ReasonSensitive,
+		},
+		"not public": {
+			st: func(st *model.Status) {
+				st.Visibility = "private"
+			},
+			reason: model.ReasonNotPublic,
+		},
+		"not discoverable": {
+			st: func(st *model.Status) {
+				st.Account.Discoverable = false
+			},
+			reason: model.ReasonNotDiscoverable,
+		},
+		"not indexable": {
+			st: func(st *model.Status) {
+				st.Account.Indexable = &indexable
+			},
+			reason: model.ReasonNotIndexable,
+		},
+		"noindex": {
+			st: func(st *model.Status) {
+				st.Account.Noindex = true
+			},
+			reason: model.ReasonNoindex,
+		},
+		"nobot status tag": {
+			st: func(st *model.Status) {
+				st.Tags = []model.Tag{{Name: "foo"}, {Name: "NoBot"}}
+			},
+			reason: model.ReasonOptOut,
+		},
+		"nobot account tag": {
+			st: func(st *model.Status) {
+				st.Account.Tags = []model.Tag{{Name: "#nobot"}}
+			},
+			reason: model.ReasonOptOut,
+		},
+		"low followers": {
+			st: func(st *model.Status) {
+				st.Account.FollowersCount = 9
+			},
+			reason: model.ReasonLowFollowers,
+		},
+		"low posts": {
+			st: func(st *model.Status) {
+				st.Account.StatusesCount = 99
+			},
+			reason: model.ReasonLowPosts,
+		},
+		"first rejection wins": {
+			st: func(st *model.Status) {
+				st.Sensitive = true
+				st.Account.FollowersCount = 0
+			},
+			reason: model.ReasonSensitive,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			st := model.Status{
+				Visibility: "public",
+				Account:    acc,
+			}
+			if c.st != nil {
+				c.st(&st)
+			}
+			d := p.Status(st)
+			assert.Equal(t, c.reason == model.ReasonNone, d.Accepted)
+			assert.Equal(t, c.reason, d.Reason)
+		})
+	}
+}
+
+func TestPolicy_Account(t *testing.T) {
+	p := newTestPolicy(t)
+	cases := map[string]struct {
+		acc    model.Account
+		reason model.Reason
+	}{
+		"accepted": {
+			acc: model.Account{
+				Discoverable:   true,
+				FollowersCount: 10,
+				StatusesCount:  100,
+			},
+		},
+		"not discoverable": {
+			acc:    model.Account{},
+			reason: model.ReasonNotDiscoverable,
+		},
+		"nobot": {
+			acc: model.Account{
+				Discoverable:   true,
+				FollowersCount: 10,
+				StatusesCount:  100,
+				Tags:           []model.Tag{{Name: "#nobot"}},
+			},
+			reason: model.ReasonOptOut,
+		},
+		"low followers": {
+			acc: model.Account{
+				Discoverable:   true,
+				FollowersCount: 9,
+				StatusesCount:  100,
+			},
+			reason: model.ReasonLowFollowers,
+		},
+		"low posts": {
+			acc: model.Account{
+				Discoverable:   true,
+				FollowersCount: 10,
+				StatusesCount:  99,
+			},
+			reason: model.ReasonLowPosts,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			d := p.Account(c.acc)
+			assert.Equal(t, c.reason == model.ReasonNone, d.Accepted)
+			assert.Equal(t, c.reason, d.Reason)
+		})
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	cfg := config.MastodonConfig{}
+	cfg.Policy.Rules = []string{RuleSensitive, "foo"}
+	_, err := NewPolicy(cfg)
+	assert.ErrorIs(t, err, ErrUnknownRule)
+	// no rules accept anything
+	cfg.Policy.Rules = nil
+	p, err := NewPolicy(cfg)
+	assert.NoError(t, err)
+	assert.True(t, p.Status(model.Status{Sensitive: true}).Accepted)
+}
+
+func TestSensitive(t *testing.T) {
+	cases := map[string]struct {
+		warned   bool
+		st       model.Status
+		accepted bool
+	}{
+		"not sensitive": {
+			st:       model.Status{},
+			accepted: true,
+		},
+		"sensitive": {
+			st: model.Status{Sensitive: true, SpoilerText: "spoilers"},
+		},
+		"warned": {
+			warned:   true,
+			st:       model.Status{Sensitive: true, SpoilerText: "spoilers"},
+			accepted: true,
+		},
+		"warned without warning": {
+			warned: true,
+			st:     model.Status{Sensitive: true, SpoilerText: " "},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.accepted, Sensitive(c.warned).Status(c.st).Accepted)
+		})
+	}
+}
+
+func TestThreadRules(t *testing.T) {
+	cases := map[string]struct {
+		rule   Policy
+		st     model.Status
+		reason model.Reason
+	}{
+		"not a boost": {
+			rule: Reblog(),
+		},
+		"boost": {
+			rule: Reblog(),
+			st: model.Status{
+				Reblog: &model.Status{},
+			},
+			reason: model.ReasonReblog,
+		},
+		"not a reply": {
+			rule: Reply(),
+		},
+		"reply": {
+			rule: Reply(),
+			st: model.Status{
+				Account:            model.Account{Id: "1"},
+				InReplyToId:        "2",
+				InReplyToAccountId: "3",
+			},
+			reason: model.ReasonReply,
+		},
+		"self reply": {
+			rule: Reply(),
+			st: model.Status{
+				Account:            model.Account{Id: "1"},
+				InReplyToId:        "2",
+				InReplyToAccountId: "1",
+			},
+		},
+		"not a quote": {
+			rule: Quote(),
+		},
+		"quote": {
+			rule: Quote(),
+			st: model.Status{
+				Quote: &model.Quote{
+					State:        model.QuoteStateAccepted,
+					QuotedStatus: &model.Status{},
+				},
+			},
+			reason: model.ReasonQuote,
+		},
+		"quote pending": {
+			rule: Quote(),
+			st: model.Status{
+				Quote: &model.Quote{
+					State: "pending",
+				},
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			d := c.rule.Status(c.st)
+			assert.Equal(t, c.reason == model.ReasonNone, d.Accepted)
+			assert.Equal(t, c.reason, d.Reason)
+		})
+	}
+}
+
+func TestNewPolicy_Reblog(t *testing.T) {
+	cfg := config.MastodonConfig{}
+	cfg.Policy.Reblog = "foo"
+	_, err := NewPolicy(cfg)
+	assert.ErrorIs(t, err, ErrUnknownReblog)
+	boost := model.Status{
+		Reblog: &model.Status{},
+	}
+	cfg.Policy.Reblog = ReblogPublish
+	p, err := NewPolicy(cfg)
+	assert.NoError(t, err)
+	assert.True(t, p.Status(boost).Accepted)
+	cfg.Policy.Reblog = ReblogSkip
+	p, err = NewPolicy(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ReasonReblog, p.Status(boost).Reason)
+}
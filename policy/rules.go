@@ -0,0 +1,115 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/awakari/int-mastodon/model"
+	"slices"
+	"strings"
+)
+
+// Sensitive rejects the statuses marked sensitive. When warned is true, the ones having the content warning are
+// accepted, so the subscribers see the warning first.
+func Sensitive(warned bool) Policy {
+	return statusRule(func(st model.Status) (d model.Decision) {
+		d = model.Accept()
+		if st.Sensitive && !(warned && strings.TrimSpace(st.SpoilerText) != "") {
+			d = model.Reject(model.ReasonSensitive, "status is marked sensitive")
+		}
+		return
+	})
+}
+
+// Visibility accepts the statuses having one of the allowed visibility values, e.g. "public".
+func Visibility(allowed ...string) Policy {
+	return statusRule(func(st model.Status) (d model.Decision) {
+		d = model.Accept()
+		if !slices.Contains(allowed, st.Visibility) {
+			d = model.Reject(model.ReasonNotPublic, fmt.Sprintf("visibility %q is not one of %v", st.Visibility, allowed))
+		}
+		return
+	})
+}
+
+func Discoverable() Policy {
+	return accountRule(func(acc model.Account) (d model.Decision) {
+		d = model.Accept()
+		if !acc.Discoverable {
+			d = model.Reject(model.ReasonNotDiscoverable, "no explicit discoverable flag set")
+		}
+		return
+	})
+}
+
+// Indexable rejects only when the flag is explicitly false, because it's sometimes missing.
+func Indexable() Policy {
+	return accountRule(func(acc model.Account) (d model.Decision) {
+		d = model.Accept()
+		if acc.Indexable != nil && !*acc.Indexable {
+			d = model.Reject(model.ReasonNotIndexable, "indexable flag is false")
+		}
+		return
+	})
+}
+
+func Noindex() Policy {
+	return accountRule(func(acc model.Account) (d model.Decision) {
+		d = model.Accept()
+		if acc.Noindex {
+			d = model.Reject(model.ReasonNoindex, "noindex flag is set")
+		}
+		return
+	})
+}
+
+// FollowersMin rejects the account with too few followers, either found or the status author.
+func FollowersMin(n uint32) Policy {
+	return accountRule(func(acc model.Account) (d model.Decision) {
+		d = model.Accept()
+		if acc.FollowersCount < n {
+			d = model.Reject(model.ReasonLowFollowers, fmt.Sprintf("followers count %d < %d", acc.FollowersCount, n))
+		}
+		return
+	})
+}
+
+// PostsMin rejects the account with too few posts, see FollowersMin.
+func PostsMin(n uint32) Policy {
+	return accountRule(func(acc model.Account) (d model.Decision) {
+		d = model.Accept()
+		if acc.StatusesCount < n {
+			d = model.Reject(model.ReasonLowPosts, fmt.Sprintf("statuses count %d < %d", acc.StatusesCount, n))
+		}
+		return
+	})
+}
+
+func Reblog() Policy {
+	return statusRule(func(st model.Status) (d model.Decision) {
+		d = model.Accept()
+		if st.Reblog != nil {
+			d = model.Reject(model.ReasonReblog, "status is a boost")
+		}
+		return
+	})
+}
+
+// Reply rejects the replies to other accounts, the author's own threads are accepted.
+func Reply() Policy {
+	return statusRule(func(st model.Status) (d model.Decision) {
+		d = model.Accept()
+		if st.InReplyToId != "" && st.InReplyToAccountId != st.Account.Id {
+			d = model.Reject(model.ReasonReply, "status is a reply to another account")
+		}
+		return
+	})
+}
+
+func Quote() Policy {
+	return statusRule(func(st model.Status) (d model.Decision) {
+		d = model.Accept()
+		if st.Quote.Quoted() != nil {
+			d = model.Reject(model.ReasonQuote, "status quotes another status")
+		}
+		return
+	})
+}
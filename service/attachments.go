@@ -0,0 +1,90 @@
+package service
+
+import (
+	"github.com/awakari/int-mastodon/model"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"math"
+)
+
+// limitAttachments caps the count of the attachments to convert, Mastodon allows 4 by default.
+const limitAttachments = 16
+
+// convertAttachments sets the attributes of every attachment, see model.CeKeyAttachment. The first attachment is also
+// described by the unindexed attributes for the existing subscriptions.
+func convertAttachments(attrs map[string]*pb.CloudEventAttributeValue, atts []model.MediaAttachment, sensitive bool) {
+	if len(atts) == 0 {
+		return
+	}
+	if len(atts) > limitAttachments {
+		atts = atts[:limitAttachments]
+	}
+	att := atts[0]
+	setString(attrs, model.CeKeyAttachmentType, att.Type)
+	u := att.PreviewUrl
+	if u == "" {
+		u = att.Url
+	}
+	setUri(attrs, model.CeKeyAttachmentUrl, u)
+	setString(attrs, model.CeKeyAttachmentDescription, att.Description)
+	attrs[model.CeKeyAttachmentSensitive] = &pb.CloudEventAttributeValue{
+		Attr: &pb.CloudEventAttributeValue_CeBoolean{
+			CeBoolean: sensitive,
+		},
+	}
+	attrs[model.CeKeyAttachmentCount] = &pb.CloudEventAttributeValue{
+		Attr: &pb.CloudEventAttributeValue_CeInteger{
+			CeInteger: int32(len(atts)),
+		},
+	}
+	for i, att := range atts {
+		setString(attrs, model.CeKeyAttachment(i, model.CeAttachmentType), att.Type)
+		setUri(attrs, model.CeKeyAttachment(i, model.CeAttachmentUrl), att.Url)
+		setUri(attrs, model.CeKeyAttachment(i, model.CeAttachmentPreviewUrl), att.PreviewUrl)
+		setUri(attrs, model.CeKeyAttachment(i, model.CeAttachmentRemoteUrl), att.RemoteUrl)
+		setString(attrs, model.CeKeyAttachment(i, model.CeAttachmentDescription), att.Description)
+		setString(attrs, model.CeKeyAttachment(i, model.CeAttachmentBlurhash), att.Blurhash)
+		dims := att.Meta.Original
+		if dims.Width == 0 || dims.Height == 0 {
+			dims.Width, dims.Height = att.Meta.Small.Width, att.Meta.Small.Height
+		}
+		if dims.Width > 0 && dims.Height > 0 {
+			setInteger(attrs, model.CeKeyAttachment(i, model.CeAttachmentWidth), dims.Width)
+			setInteger(attrs, model.CeKeyAttachment(i, model.CeAttachmentHeight), dims.Height)
+		}
+		if dims.Duration > 0 {
+			// whole seconds, so the short clips don't become zero
+			setInteger(attrs, model.CeKeyAttachment(i, model.CeAttachmentDuration), uint32(math.Ceil(dims.Duration)))
+		}
+	}
+}
+
+func setString(attrs map[string]*pb.CloudEventAttributeValue, k, v string) {
+	if v != "" {
+		attrs[k] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeString{
+				CeString: v,
+			},
+		}
+	}
+}
+
+func setUri(attrs map[string]*pb.CloudEventAttributeValue, k, v string) {
+	if v != "" {
+		attrs[k] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeUri{
+				CeUri: v,
+			},
+		}
+	}
+}
+
+func setInteger(attrs map[string]*pb.CloudEventAttributeValue, k string, v uint32) {
+	if v > math.MaxInt32 {
+		v = math.MaxInt32
+	}
+	attrs[k] = &pb.CloudEventAttributeValue{
+		Attr: &pb.CloudEventAttributeValue_CeInteger{
+			CeInteger: int32(v),
+		},
+	}
+}
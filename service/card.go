@@ -0,0 +1,15 @@
+package service
+
+import (
+	"github.com/awakari/int-mastodon/model"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+)
+
+// convertCard sets the link preview attributes.
+func convertCard(attrs map[string]*pb.CloudEventAttributeValue, c model.Card) {
+	setString(attrs, model.CeKeyCardTitle, c.Title)
+	setString(attrs, model.CeKeyCardDescription, c.Description)
+	setString(attrs, model.CeKeyCardProvider, c.ProviderName)
+	setUri(attrs, model.CeKeyCardUrl, c.Url)
+	setUri(attrs, model.CeKeyCardImage, c.Image)
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// index keeps the limited count of the recently published statuses, so the live stream deletions
+// (carrying only the host-local status id) may be resolved to the published status.
+type index struct {
+	lock  sync.Mutex
+	limit int
+	keys  []string
+	next  int
+	items map[string]indexItem
+}
+
+type indexItem struct {
+	key       string
+	uri       string
+	url       string
+	userId    string
+	createdAt time.Time
+	// conversation is the thread root URI, if known
+	conversation string
+}
+
+func newIndex(limit int) *index {
+	return &index{
+		limit: limit,
+		keys:  make([]string, limit),
+		items: make(map[string]indexItem, limit),
+	}
+}
+
+func (idx *index) put(key string, item indexItem) {
+	if idx.limit < 1 {
+		return
+	}
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if _, exists := idx.items[key]; !exists {
+		// evict the oldest key
+		delete(idx.items, idx.keys[idx.next])
+		idx.keys[idx.next] = key
+		idx.next = (idx.next + 1) % idx.limit
+	}
+	idx.items[key] = item
+}
+
+func (idx *index) get(key string) (item indexItem, found bool) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	item, found = idx.items[key]
+	return
+}
@@ -27,8 +27,38 @@ func (l logging) SearchAndAdd(ctx context.Context, subId, groupId, q string, lim
 	return
 }
 
-func (l logging) HandleLiveStreamEvents(ctx context.Context, evts []*pb.CloudEvent) {
-	l.svc.HandleLiveStreamEvents(ctx, evts)
-	l.log.Debug(fmt.Sprintf("service.HandleLiveStreamEvents(%d)", len(evts)))
+func (l logging) RemoveSources(ctx context.Context, subId, groupId, q string, typ model.SearchType) (n uint32, err error) {
+	n, err = l.svc.RemoveSources(ctx, subId, groupId, q, typ)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("service.RemoveSources(subId=%s, groupId=%s, q=%s, typ=%s): %d, %s", subId, groupId, q, typ.String(), n, err))
+	return
+}
+
+func (l logging) Search(ctx context.Context, q string, limit uint32, typ model.SearchType) (candidates []model.Candidate, err error) {
+	candidates, err = l.svc.Search(ctx, q, limit, typ)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("service.Search(q=%s, limit=%d, typ=%s): %d, %s", q, limit, typ.String(), len(candidates), err))
+	return
+}
+
+func (l logging) ListSources(ctx context.Context, subId string) (srcs []model.Source, err error) {
+	srcs, err = l.svc.ListSources(ctx, subId)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("service.ListSources(subId=%s): %d, %s", subId, len(srcs), err))
+	return
+}
+
+func (l logging) FollowTags(ctx context.Context, interestId string, queries []string) (tags []string, err error) {
+	tags, err = l.svc.FollowTags(ctx, interestId, queries)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("service.FollowTags(interestId=%s, queries=%d): %v, %s", interestId, len(queries), tags, err))
+	return
+}
+
+func (l logging) PollTags(ctx context.Context) (n uint32, err error) {
+	n, err = l.svc.PollTags(ctx)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("service.PollTags(): %d, %s", n, err))
+	return
+}
+
+func (l logging) HandleLiveStreamEvents(ctx context.Context, evts []*pb.CloudEvent) (n uint32, err error) {
+	n, err = l.svc.HandleLiveStreamEvents(ctx, evts)
+	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("service.HandleLiveStreamEvents(%d): %d, %s", len(evts), n, err))
 	return
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/awakari/int-mastodon/model"
 	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"time"
 )
 
 type mock struct {
@@ -17,6 +18,50 @@ func (m mock) SearchAndAdd(ctx context.Context, subId, groupId, q string, limit
 	return 42, nil
 }
 
-func (m mock) HandleLiveStreamEvents(ctx context.Context, evts []*pb.CloudEvent) {
+func (m mock) RemoveSources(ctx context.Context, subId, groupId, q string, typ model.SearchType) (n uint32, err error) {
+	return 1, nil
+}
+
+func (m mock) Search(ctx context.Context, q string, limit uint32, typ model.SearchType) (candidates []model.Candidate, err error) {
+	candidates = []model.Candidate{
+		{
+			AccountUri: "https://host1/users/john",
+			Host:       "host1",
+			Decision:   model.Accept(),
+		},
+		{
+			AccountUri: "https://host1/users/jane",
+			Host:       "host1",
+			Decision:   model.Reject(model.ReasonNoindex, "noindex flag is set"),
+		},
+	}
+	return
+}
+
+func (m mock) ListSources(ctx context.Context, subId string) (srcs []model.Source, err error) {
+	srcs = []model.Source{
+		{
+			AccountUri: "https://host1/users/john",
+			Host:       "host1",
+			InterestId: subId,
+			GroupId:    "group1",
+			Query:      "q1",
+			Time:       time.Date(2024, 12, 20, 10, 40, 15, 0, time.UTC),
+			Outcome:    model.SourceOutcomeDelegated,
+			Decision:   model.Accept(),
+		},
+	}
+	return
+}
+
+func (m mock) HandleLiveStreamEvents(ctx context.Context, evts []*pb.CloudEvent) (n uint32, err error) {
+	return uint32(len(evts)), nil
+}
+
+func (m mock) FollowTags(ctx context.Context, interestId string, queries []string) (tags []string, err error) {
+	return tagsOf(queries), nil
+}
+
+func (m mock) PollTags(ctx context.Context) (n uint32, err error) {
 	return
 }
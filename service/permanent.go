@@ -0,0 +1,32 @@
+package service
+
+import (
+	"errors"
+	ap "github.com/awakari/int-mastodon/api/grpc/int-activitypub"
+	apiMastodon "github.com/awakari/int-mastodon/api/http/mastodon"
+	"github.com/awakari/int-mastodon/api/http/ratelimit"
+	"net/http"
+)
+
+// Permanent returns true when the failure is not going to disappear on the redelivery, e.g. the Mastodon API client
+// error or the exhausted rate limit. The joined errors are permanent only when every of them is.
+func Permanent(err error) (ok bool) {
+	if joined, isJoined := err.(interface{ Unwrap() []error }); isJoined {
+		for _, e := range joined.Unwrap() {
+			if !Permanent(e) {
+				return false
+			}
+		}
+		return len(joined.Unwrap()) > 0
+	}
+	var errApi apiMastodon.ApiError
+	switch {
+	case err == nil:
+	case errors.As(err, &errApi):
+		ok = errApi.StatusCode >= 400 && errApi.StatusCode < 500 &&
+			errApi.StatusCode != http.StatusRequestTimeout && errApi.StatusCode != http.StatusTooManyRequests
+	case errors.Is(err, ratelimit.ErrLimited), errors.Is(err, ap.ErrInvalid):
+		ok = true
+	}
+	return
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ap "github.com/awakari/int-mastodon/api/grpc/int-activitypub"
+	apiMastodon "github.com/awakari/int-mastodon/api/http/mastodon"
+	"github.com/awakari/int-mastodon/api/http/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestPermanent(t *testing.T) {
+	errForbidden := fmt.Errorf("failed to follow: %w", apiMastodon.ApiError{StatusCode: http.StatusForbidden})
+	cases := map[string]struct {
+		err       error
+		permanent bool
+	}{
+		"none": {},
+		"api client error": {
+			err:       errForbidden,
+			permanent: true,
+		},
+		"api throttled": {
+			err: apiMastodon.ApiError{StatusCode: http.StatusTooManyRequests},
+		},
+		"api server error": {
+			err: apiMastodon.ApiError{StatusCode: http.StatusBadGateway},
+		},
+		"rate limited": {
+			err:       ratelimit.ErrLimited,
+			permanent: true,
+		},
+		"activitypub invalid": {
+			err:       ap.ErrInvalid,
+			permanent: true,
+		},
+		"activitypub internal": {
+			err: ap.ErrInternal,
+		},
+		"timeout": {
+			err: context.DeadlineExceeded,
+		},
+		"joined permanent": {
+			err:       errors.Join(errForbidden, ratelimit.ErrLimited),
+			permanent: true,
+		},
+		"joined with transient": {
+			err: errors.Join(errForbidden, ap.ErrInternal),
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.permanent, Permanent(c.err))
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"fmt"
+	"github.com/awakari/int-mastodon/content"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strings"
+	"time"
+)
+
+// convertPoll sets the poll attributes and returns the poll rendered as text, e.g.:
+//
+//	Poll, 12 votes, ends 2024-12-21T10:40:15Z:
+//	- yes: 7
+//	- no: 5
+func convertPoll(attrs map[string]*pb.CloudEventAttributeValue, p model.Poll) (txt string) {
+	emojis := emojiUrls(p.Emojis)
+	var sb strings.Builder
+	sb.WriteString("Poll")
+	if p.Multiple {
+		sb.WriteString(" (multiple choice)")
+	}
+	sb.WriteString(fmt.Sprintf(", %d votes", p.VotesCount))
+	if p.ExpiresAt != nil {
+		verb := "ends"
+		if p.Expired {
+			verb = "ended"
+		}
+		sb.WriteString(", " + verb + " " + p.ExpiresAt.UTC().Format(time.RFC3339))
+		attrs[model.CeKeyPollExpires] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeTimestamp{
+				CeTimestamp: timestamppb.New(p.ExpiresAt.UTC()),
+			},
+		}
+	}
+	sb.WriteString(":")
+	setInteger(attrs, model.CeKeyPollVotes, p.VotesCount)
+	attrs[model.CeKeyPollMultiple] = &pb.CloudEventAttributeValue{
+		Attr: &pb.CloudEventAttributeValue_CeBoolean{
+			CeBoolean: p.Multiple,
+		},
+	}
+	for i, o := range p.Options {
+		title := content.EmojiNames(o.Title, emojis)
+		sb.WriteString("\n- " + title)
+		setString(attrs, model.CeKeyPollOption(i), title)
+		if o.VotesCount != nil {
+			sb.WriteString(fmt.Sprintf(": %d", *o.VotesCount))
+			setInteger(attrs, model.CeKeyPollOptionVotes(i), *o.VotesCount)
+		}
+	}
+	txt = sb.String()
+	return
+}
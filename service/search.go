@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	apiMastodon "github.com/awakari/int-mastodon/api/http/mastodon"
+	"github.com/awakari/int-mastodon/instance"
+	"github.com/awakari/int-mastodon/model"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// found is the search result item, either status or account, on the host.
+type found struct {
+	host    string
+	tokAuth string
+	st      *model.Status
+	acc     model.Account
+}
+
+// searchAll runs the search on every host concurrently, paging until the limit is reached on every host. Then merges
+// the results, so the same account found on several hosts is handled once, preferably via its home host. The
+// statuses are deduplicated by their URIs. When the cursor key is not empty, only the statuses newer than the ones
+// found before are searched, the returned cursors are to remember after the found items are handled.
+func (m mastodon) searchAll(ctx context.Context, q string, limit uint32, typ model.SearchType, cursorKey string) (items []found, cursors []model.Cursor, err error) {
+	hosts := m.cfg.Client.Hosts
+	hostItems := make([][]found, len(hosts))
+	hostCursors := make([]model.Cursor, len(hosts))
+	err = m.eachHost(ctx, func(ctx context.Context, i int, host, tokAuth string) (err error) {
+		hostItems[i], hostCursors[i], err = m.searchHost(ctx, host, tokAuth, q, limit, typ, cursorKey)
+		return
+	})
+	items = mergeFound(hostItems)
+	for _, c := range hostCursors {
+		if c.Id != "" {
+			cursors = append(cursors, c)
+		}
+	}
+	return
+}
+
+// eachHost calls the function for every host concurrently within the configured concurrency limit and the per-host
+// timeout, so a hung host doesn't stall the others. Returns the joined errors.
+func (m mastodon) eachHost(ctx context.Context, f func(ctx context.Context, i int, host, tokAuth string) error) (err error) {
+	hosts := m.cfg.Client.Hosts
+	hostErrs := make([]error, len(hosts))
+	sem := make(chan struct{}, max(1, int(m.cfg.Search.Concurrency)))
+	wg := sync.WaitGroup{}
+	for i, host := range hosts {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ctxHost := ctx
+			if m.cfg.Search.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctxHost, cancel = context.WithTimeout(ctx, m.cfg.Search.Timeout)
+				defer cancel()
+			}
+			hostErrs[i] = f(ctxHost, i, host, m.cfg.Client.Tokens[i])
+		}()
+	}
+	wg.Wait()
+	err = errors.Join(hostErrs...)
+	return
+}
+
+// searchHost pages the search results on the host within the page count limit. The
+// statuses are paged by the max_id cursor, as the offset is unstable while the new statuses arrive, the accounts by
+// the offset. Returns the cursor to the newest status found if any.
+func (m mastodon) searchHost(ctx context.Context, host, tokAuth, q string, limit uint32, typ model.SearchType, cursorKey string) (items []found, cursor model.Cursor, err error) {
+	var page apiMastodon.Page
+	if cursorKey != "" && typ == model.SearchTypeStatuses {
+		page.MinId, err = m.stor.Cursor(ctx, host, cursorKey)
+	}
+	var n, offset uint32
+	pagesMax := max(1, m.cfg.Search.PagesMax)
+paging:
+	for pages := uint32(0); err == nil && n < limit && pages < pagesMax; pages++ {
+		page.Limit = limit - n
+		var results model.Results
+		var links apiMastodon.Links
+		results, links, err = m.client.Search(ctx, host, tokAuth, q, typ, true, offset, page)
+		if err != nil {
+			break
+		}
+		var countResults int
+		switch typ {
+		case model.SearchTypeStatuses:
+			countResults = len(results.Statuses)
+			for _, st := range results.Statuses {
+				items = append(items, found{
+					host:    host,
+					tokAuth: tokAuth,
+					st:      &st,
+					acc:     st.Account,
+				})
+			}
+		case model.SearchTypeAccounts:
+			countResults = len(results.Accounts)
+			for _, acc := range results.Accounts {
+				items = append(items, found{
+					host:    host,
+					tokAuth: tokAuth,
+					acc:     acc,
+				})
+			}
+		}
+		if countResults == 0 {
+			break
+		}
+		n += uint32(countResults)
+		switch typ {
+		case model.SearchTypeStatuses:
+			// the server may ignore the cursor
+			if links.Next.MaxId == "" || links.Next.MaxId == page.MaxId {
+				break paging
+			}
+			page.MaxId = links.Next.MaxId
+		case model.SearchTypeAccounts:
+			offset = n
+		}
+	}
+	// the server may ignore the limit
+	if uint32(len(items)) > limit {
+		items = items[:limit]
+	}
+	if cursorKey != "" {
+		for _, item := range items {
+			if item.st != nil && model.IdNewer(item.st.Id, page.MinId) && model.IdNewer(item.st.Id, cursor.Id) {
+				cursor = model.Cursor{
+					Host: host,
+					Key:  cursorKey,
+					Id:   item.st.Id,
+				}
+			}
+		}
+	}
+	return
+}
+
+// mergeFound keeps the order of the accounts first found, the items found on the account home host go first.
+func mergeFound(hostItems [][]found) (items []found) {
+	var keys []string
+	byAcc := make(map[string][]found)
+	for _, hi := range hostItems {
+		for _, item := range hi {
+			k := accountKey(item)
+			if _, exists := byAcc[k]; !exists {
+				keys = append(keys, k)
+			}
+			byAcc[k] = append(byAcc[k], item)
+		}
+	}
+	for _, k := range keys {
+		accItems := byAcc[k]
+		slices.SortStableFunc(accItems, func(a, b found) int {
+			switch {
+			case a.home() && !b.home():
+				return -1
+			case !a.home() && b.home():
+				return 1
+			}
+			return 0
+		})
+		seen := make(map[string]bool)
+		for _, item := range accItems {
+			// single item per account when searching accounts
+			var kItem string
+			if item.st != nil {
+				kItem = item.st.Uri
+				if kItem == "" {
+					kItem = item.host + "/" + item.st.Id
+				}
+			}
+			if !seen[kItem] {
+				seen[kItem] = true
+				items = append(items, item)
+			}
+		}
+	}
+	return
+}
+
+func accountKey(item found) (k string) {
+	switch {
+	case item.acc.Uri != "":
+		k = item.acc.Uri
+	case item.acc.Url != "":
+		k = item.acc.Url
+	default:
+		k = item.host + "/" + item.acc.Acct
+	}
+	return
+}
+
+// home returns true when the item is found on the account home host, so no federation is involved.
+func (item found) home() bool {
+	host := item.host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return slices.Contains(instance.Domains(item.acc), strings.ToLower(host))
+}
@@ -2,159 +2,205 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	ap "github.com/awakari/int-mastodon/api/grpc/int-activitypub"
+	apiMastodon "github.com/awakari/int-mastodon/api/http/mastodon"
 	"github.com/awakari/int-mastodon/api/http/pub"
 	"github.com/awakari/int-mastodon/config"
+	"github.com/awakari/int-mastodon/content"
+	"github.com/awakari/int-mastodon/instance"
 	"github.com/awakari/int-mastodon/model"
+	"github.com/awakari/int-mastodon/policy"
+	"github.com/awakari/int-mastodon/storage"
 	"github.com/bytedance/sonic"
 	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
 	"github.com/segmentio/ksuid"
 	"google.golang.org/protobuf/types/known/timestamppb"
-	"io"
-	"net/http"
-	"net/url"
-	"strconv"
+	"log/slog"
+	"math"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Service interface {
 	SearchAndAdd(ctx context.Context, interestId, groupId, q string, limit uint32, typ model.SearchType) (n uint32, err error)
-	HandleLiveStreamEvents(ctx context.Context, evts []*pb.CloudEvent)
+
+	// RemoveSources reverts SearchAndAdd for the interest: unfollows the accounts matching the query or deletes the
+	// sources found by the statuses unless these are used by another interest. Returns the count of removed sources.
+	RemoveSources(ctx context.Context, interestId, groupId, q string, typ model.SearchType) (n uint32, err error)
+
+	// Search finds the candidate accounts the same way as SearchAndAdd but doesn't add any (dry run).
+	Search(ctx context.Context, q string, limit uint32, typ model.SearchType) (candidates []model.Candidate, err error)
+
+	// ListSources returns the decisions made about the accounts found for the interest.
+	ListSources(ctx context.Context, interestId string) (srcs []model.Source, err error)
+
+	// HandleLiveStreamEvents returns the count of the leading events handled successfully.
+	HandleLiveStreamEvents(ctx context.Context, evts []*pb.CloudEvent) (n uint32, err error)
+
+	// FollowTags replaces the hashtags to poll for the interest by the ones found in its queries. No queries stop
+	// polling the interest's hashtags. Returns the hashtags followed for the interest.
+	FollowTags(ctx context.Context, interestId string, queries []string) (tags []string, err error)
+
+	// PollTags fetches the new statuses having the followed hashtags on every host and handles them the same way as
+	// the live stream ones. Returns the count of the statuses handled successfully.
+	PollTags(ctx context.Context) (n uint32, err error)
 }
 
 type mastodon struct {
-	clientHttp     *http.Client
-	userAgent      string
+	client         apiMastodon.Client
 	cfg            config.MastodonConfig
 	svcAp          ap.Service
 	svcPub         pub.Service
 	typeCloudEvent string
+	typeDelete     string
+	published      *index
+	pol            policy.Policy
+	instances      instance.Service
+	stor           storage.Storage
+	log            *slog.Logger
+	// tagsLock serializes the followed hashtags changes, see FollowTags
+	tagsLock *sync.Mutex
 }
 
-const limitRespBodyLen = 1_048_576
-const limitRespBodyLenErr = 1_024
 const groupIdDefault = "default"
-const tagNoBot = "#nobot"
-const ksuidEnthropyLenMax = 16
+const ksuidPayloadLen = 16
+const streamEvtTypeUpdate = "update"
+const streamEvtTypeStatusUpdate = "status.update"
+const streamEvtTypeDelete = "delete"
+
+// pending is the event to publish with the optional index entry to remember after publishing
+type pending struct {
+	evtIdx  int
+	evt     *pb.CloudEvent
+	userId  string
+	idxKey  string
+	idxItem indexItem
+}
 
 func NewService(
-	clientHttp *http.Client,
-	userAgent string,
+	client apiMastodon.Client,
 	cfg config.MastodonConfig,
 	svcAp ap.Service,
 	svcPub pub.Service,
 	typeCloudEvent string,
+	typeDelete string,
+	pol policy.Policy,
+	instances instance.Service,
+	stor storage.Storage,
+	log *slog.Logger,
 ) Service {
 	if len(cfg.Client.Hosts) != len(cfg.Client.Tokens) {
 		panic(fmt.Sprintf("count of mastodon's hosts %d does not match the count of tokens %d", len(cfg.Client.Hosts), len(cfg.Client.Tokens)))
 	}
 	return mastodon{
-		clientHttp:     clientHttp,
-		userAgent:      userAgent,
+		client:         client,
 		cfg:            cfg,
 		svcAp:          svcAp,
 		svcPub:         svcPub,
 		typeCloudEvent: typeCloudEvent,
+		typeDelete:     typeDelete,
+		published:      newIndex(int(cfg.Stream.IndexSize)),
+		pol:            pol,
+		instances:      instances,
+		stor:           stor,
+		log:            log,
+		tagsLock:       &sync.Mutex{},
 	}
 }
 
-func (m mastodon) SearchAndAdd(ctx context.Context, interestId, groupId, q string, limit uint32, typ model.SearchType) (nTotal uint32, errs error) {
-	for i, host := range m.cfg.Client.Hosts {
-		tokenAuth := m.cfg.Client.Tokens[i]
-		var n uint32
-		for n < limit {
-			reqQuery := "?q=" + url.QueryEscape(q) + "&type=" + typ.String() + "&resolve=true&offset=" + strconv.Itoa(int(n)) + "&limit=" + strconv.Itoa(int(limit-n))
-			var req *http.Request
-			var err error
-			req, err = http.NewRequestWithContext(ctx, http.MethodGet, m.cfg.Endpoint.Protocol+host+m.cfg.Endpoint.Search+reqQuery, nil)
-			var resp *http.Response
-			if err == nil {
-				req.Header.Add("Accept", "application/json")
-				req.Header.Add("Authorization", "Bearer "+tokenAuth)
-				req.Header.Add("User-Agent", m.userAgent)
-				resp, err = m.clientHttp.Do(req)
-			}
-			var data []byte
-			if err == nil && resp != nil {
-				data, err = io.ReadAll(io.LimitReader(resp.Body, limitRespBodyLen))
-				_ = resp.Body.Close()
-			}
-			var results model.Results
-			if err == nil {
-				err = sonic.Unmarshal(data, &results)
-			}
-			if err != nil {
-				errs = errors.Join(errs, err)
-				break
-			}
-			if typ == model.SearchTypeStatuses {
-				countResults := len(results.Statuses)
-				if countResults == 0 {
-					break
-				}
-				n += uint32(countResults)
-				for _, st := range results.Statuses {
-					err = m.processFoundStatus(ctx, host, tokenAuth, st, interestId, groupId, q)
-					if err != nil {
-						err = errors.Join(errs, err)
-					}
-				}
-			} else if typ == model.SearchTypeAccounts {
-				countResults := len(results.Accounts)
-				if countResults == 0 {
-					break
-				}
-				n += uint32(countResults)
-				for _, acc := range results.Accounts {
-					err = m.processFoundAccount(ctx, host, tokenAuth, acc, interestId, groupId, q, false)
-					if err != nil {
-						errs = errors.Join(errs, err)
-					}
-				}
-			}
+func (m mastodon) SearchAndAdd(ctx context.Context, interestId, groupId, q string, limit uint32, typ model.SearchType) (n uint32, err error) {
+	var items []found
+	var cursors []model.Cursor
+	items, cursors, err = m.searchAll(ctx, q, limit, typ, cursorKeySearch(interestId, q))
+	n = uint32(len(items))
+	var errProc error
+	for _, item := range items {
+		switch item.st {
+		case nil:
+			errProc = errors.Join(errProc, m.processFoundAccount(ctx, item.host, item.tokAuth, item.acc, interestId, groupId, q, false))
+		default:
+			errProc = errors.Join(errProc, m.processFoundStatus(ctx, item.host, item.tokAuth, *item.st, interestId, groupId, q))
+		}
+	}
+	// otherwise search the same statuses again on the redelivery
+	if errProc == nil {
+		for _, c := range cursors {
+			errProc = errors.Join(errProc, m.stor.PutCursor(ctx, c))
 		}
-		nTotal += n
 	}
+	err = errors.Join(err, errProc)
 	return
 }
 
-func (m mastodon) processFoundStatus(ctx context.Context, host, tokAuth string, s model.Status, interestId, groupId, q string) (err error) {
-	if s.Sensitive {
-		err = fmt.Errorf("found account %s skip due to sensitive flag", s.Account.Uri)
-	}
-	acc := s.Account
-	if err == nil && acc.FollowersCount < m.cfg.CountMin.Followers {
-		err = fmt.Errorf("found account %s skip due low followers count %d", acc.Uri, acc.FollowersCount)
+// cursorKeySearch identifies the interest's search query cursors.
+func cursorKeySearch(interestId, q string) string {
+	return "search/" + interestId + "/" + q
+}
+
+func (m mastodon) Search(ctx context.Context, q string, limit uint32, typ model.SearchType) (candidates []model.Candidate, err error) {
+	var items []found
+	items, _, err = m.searchAll(ctx, q, limit, typ, "")
+	for _, item := range items {
+		switch item.st {
+		case nil:
+			candidates = append(candidates, model.Candidate{
+				AccountUri: item.acc.Uri,
+				Host:       item.host,
+				Decision:   m.decideAccount(ctx, item.acc),
+			})
+		default:
+			candidates = append(candidates, model.Candidate{
+				AccountUri: item.acc.Uri,
+				StatusUri:  item.st.Uri,
+				Host:       item.host,
+				Decision:   m.decideStatus(ctx, *item.st),
+			})
+		}
 	}
-	if err == nil && acc.StatusesCount < m.cfg.CountMin.Followers {
-		err = fmt.Errorf("found account %s skip due low post count %d", acc.Uri, acc.StatusesCount)
+	return
+}
+
+func (m mastodon) ListSources(ctx context.Context, interestId string) (srcs []model.Source, err error) {
+	return m.stor.List(ctx, model.SourceFilter{
+		InterestId: interestId,
+	})
+}
+
+func (m mastodon) processFoundStatus(ctx context.Context, host, tokAuth string, s model.Status, interestId, groupId, q string) (err error) {
+	d := m.decideStatus(ctx, s)
+	switch d.Accepted {
+	case true:
+		err = m.processFoundAccount(ctx, host, tokAuth, s.Account, interestId, groupId, q, true)
+	default:
+		m.log.Debug(fmt.Sprintf("found status %s, interest %s: %s", s.Uri, interestId, d))
 	}
-	err = m.processFoundAccount(ctx, host, tokAuth, acc, interestId, groupId, q, true)
 	return
 }
 
 func (m mastodon) processFoundAccount(ctx context.Context, host, tokAuth string, acc model.Account, interestId, groupId, q string, delegateFollow bool) (err error) {
-	if !acc.Discoverable {
-		err = fmt.Errorf("found account %s skip due to no explicit discoverable flag set", acc.Uri)
+	src := model.Source{
+		AccountUri: acc.Uri,
+		Host:       host,
+		InterestId: interestId,
+		GroupId:    groupId,
+		Query:      q,
 	}
-	if err == nil && acc.Indexable != nil && !*acc.Indexable {
-		err = fmt.Errorf("found account %s skip due to no explicit indexable flag set", acc.Uri)
-	}
-	if err == nil && acc.Noindex {
-		err = fmt.Errorf("found account %s skip due to noindex flag", acc.Uri)
+	var known bool
+	known, err = m.knownSource(ctx, src, delegateFollow)
+	if err == nil && known {
+		return
 	}
+	var d model.Decision
 	if err == nil {
-		for _, t := range acc.Tags {
-			if strings.ToLower(t.Name) == tagNoBot {
-				err = fmt.Errorf("found account %s skip due to %s tag", acc.Uri, tagNoBot)
-				break
-			}
-		}
+		d = m.decideAccount(ctx, acc)
+		src.Decision = d
 	}
-	if err == nil {
+	if err == nil && d.Accepted {
 		switch delegateFollow {
 		case true:
 			err = m.svcAp.Create(ctx, acc.Uri, groupId, "", interestId, q)
@@ -162,134 +208,367 @@ func (m mastodon) processFoundAccount(ctx context.Context, host, tokAuth string,
 			err = m.follow(ctx, acc, host, tokAuth)
 		}
 	}
+	// remember the decision
+	src.Time = time.Now().UTC()
+	switch {
+	case err != nil:
+		src.Outcome = model.SourceOutcomeFailed
+		src.Error = err.Error()
+	case !d.Accepted:
+		src.Outcome = model.SourceOutcomeRejected
+	case delegateFollow:
+		src.Outcome = model.SourceOutcomeDelegated
+	default:
+		src.Outcome = model.SourceOutcomeFollowed
+	}
+	m.log.Debug(fmt.Sprintf("found account %s, interest %s: %s, %s", acc.Uri, interestId, d, src.Outcome))
+	err = errors.Join(err, m.stor.Put(ctx, src))
 	return
 }
 
-func (m mastodon) follow(ctx context.Context, acc model.Account, host, tokAuth string) (err error) {
-	var req *http.Request
-	req, err = http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.Endpoint.Protocol+host+m.cfg.Endpoint.Accounts+"/"+acc.Id+"/follow", nil)
-	var resp *http.Response
-	if err == nil {
-		req.Header.Add("Accept", "application/json")
-		req.Header.Add("Authorization", "Bearer "+tokAuth)
-		req.Header.Add("User-Agent", m.userAgent)
-		resp, err = m.clientHttp.Do(req)
+// decideStatus applies the policy to the status first, then checks the author's instance.
+func (m mastodon) decideStatus(ctx context.Context, st model.Status) (d model.Decision) {
+	d = m.pol.Status(st)
+	if d.Accepted {
+		d = m.decideInstance(ctx, st.Account)
 	}
-	if err == nil {
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			data, _ := io.ReadAll(io.LimitReader(resp.Body, limitRespBodyLenErr))
-			err = fmt.Errorf(
-				"failed to follow the account %s: request_url=%s, request_headers=%+v, response=%d/%s",
-				acc.Acct,
-				req.URL,
-				req.Header,
-				resp.StatusCode,
-				string(data),
-			)
+	return
+}
+
+// decideAccount applies the policy to the account first, then checks the account's instance.
+func (m mastodon) decideAccount(ctx context.Context, acc model.Account) (d model.Decision) {
+	d = m.pol.Account(acc)
+	if d.Accepted {
+		d = m.decideInstance(ctx, acc)
+	}
+	return
+}
+
+func (m mastodon) decideInstance(ctx context.Context, acc model.Account) (d model.Decision) {
+	d = model.Accept()
+	for _, domain := range instance.Domains(acc) {
+		d = m.instances.Check(ctx, domain)
+		if !d.Accepted {
+			break
 		}
 	}
 	return
 }
 
-func (m mastodon) HandleLiveStreamEvents(ctx context.Context, evts []*pb.CloudEvent) {
-	for _, evt := range evts {
-		if "update" == string(evt.Type) {
-			var st model.Status
-			err := sonic.Unmarshal(evt.GetBinaryData(), &st)
-			if err != nil {
-				fmt.Printf("failed to unmarshal the live stream event data: %s\nerror: %s\n", string(evt.GetBinaryData()), err)
-			}
+// knownSource returns true if the account is already added for the interest. The follow delegated to int-activitypub
+// doesn't depend on the host where the account is found.
+func (m mastodon) knownSource(ctx context.Context, src model.Source, delegated bool) (known bool, err error) {
+	filter := model.SourceFilter{
+		AccountUri: src.AccountUri,
+		InterestId: src.InterestId,
+	}
+	outcome := model.SourceOutcomeDelegated
+	if !delegated {
+		filter.Host = src.Host
+		outcome = model.SourceOutcomeFollowed
+	}
+	var srcs []model.Source
+	srcs, err = m.stor.List(ctx, filter)
+	for _, s := range srcs {
+		if s.Outcome == outcome {
+			known = true
+			break
+		}
+	}
+	return
+}
 
-			// do not proceed if either of below conditions is true
-			if st.Sensitive {
-				return
-			}
-			if st.Visibility != "public" {
-				return
+func (m mastodon) follow(ctx context.Context, acc model.Account, host, tokAuth string) (err error) {
+	_, err = m.client.Follow(ctx, host, tokAuth, acc.Id)
+	if err != nil {
+		err = fmt.Errorf("failed to follow the account %s: %w", acc.Acct, err)
+	}
+	return
+}
+
+func (m mastodon) unfollow(ctx context.Context, acc model.Account, host, tokAuth string) (err error) {
+	_, err = m.client.Unfollow(ctx, host, tokAuth, acc.Id)
+	if err != nil {
+		err = fmt.Errorf("failed to unfollow the account %s: %w", acc.Acct, err)
+	}
+	return
+}
+
+func (m mastodon) RemoveSources(ctx context.Context, interestId, groupId, q string, typ model.SearchType) (n uint32, errs error) {
+	switch typ {
+	case model.SearchTypeAccounts:
+		// the followed account is the interest's own actor, resolve it again in case it's not in the storage
+		var count atomic.Uint32
+		errs = m.eachHost(ctx, func(ctx context.Context, _ int, host, tokAuth string) (err error) {
+			var results model.Results
+			results, _, err = m.client.Search(ctx, host, tokAuth, q, typ, false, 0, apiMastodon.Page{Limit: 1})
+			for _, acc := range results.Accounts {
+				if err == nil && strings.EqualFold(strings.TrimPrefix(acc.Acct, "@"), strings.TrimPrefix(q, "@")) {
+					err = m.unfollow(ctx, acc, host, tokAuth)
+					if err == nil {
+						_, err = m.stor.Delete(ctx, model.SourceFilter{
+							AccountUri: acc.Uri,
+							Host:       host,
+							InterestId: interestId,
+						})
+					}
+					if err == nil {
+						count.Add(1)
+					}
+				}
 			}
-			acc := st.Account
-			if !acc.Discoverable {
-				return
+			return
+		})
+		n = count.Load()
+	case model.SearchTypeStatuses:
+		// same as the sources, regardless of the query
+		errs = errors.Join(errs, m.stor.DeleteCursors(ctx, cursorKeySearch(interestId, "")))
+		// the local registry may miss the sources added by another replica or before a restart,
+		// so let int-activitypub delete everything it follows for the interest
+		err := m.svcAp.Delete(ctx, "", groupId, "", interestId)
+		if err != nil {
+			// keep the local sources to retry on the redelivery
+			errs = errors.Join(errs, err)
+			return
+		}
+		var srcs []model.Source
+		srcs, err = m.stor.List(ctx, model.SourceFilter{
+			InterestId: interestId,
+		})
+		errs = errors.Join(errs, err)
+		for _, src := range srcs {
+			switch src.Outcome {
+			case model.SourceOutcomeFollowed:
+				// removed by the accounts search type
+				continue
+			case model.SourceOutcomeDelegated:
+				n++
 			}
-			if acc.Noindex {
-				return
+			_, err = m.stor.Delete(ctx, model.SourceFilter{
+				AccountUri: src.AccountUri,
+				Host:       src.Host,
+				InterestId: interestId,
+			})
+			errs = errors.Join(errs, err)
+		}
+	}
+	return
+}
+
+func (m mastodon) HandleLiveStreamEvents(ctx context.Context, evts []*pb.CloudEvent) (n uint32, err error) {
+	n = uint32(len(evts))
+	var pubs []pending
+	// the statuses published within the same batch are not in the index yet
+	recent := make(map[string]indexItem)
+	for i, evt := range evts {
+		switch evt.Type {
+		case streamEvtTypeUpdate, streamEvtTypeStatusUpdate:
+			var st model.Status
+			errUnmarshal := sonic.Unmarshal(evt.GetBinaryData(), &st)
+			if errUnmarshal != nil {
+				// redelivery won't help
+				m.log.Warn(fmt.Sprintf("failed to unmarshal the live stream event data: %s, error: %s", string(evt.GetBinaryData()), errUnmarshal))
+				continue
 			}
-			for _, t := range st.Tags {
-				if strings.ToLower(t.Name) == tagNoBot {
-					return
+			switch evt.Type {
+			case streamEvtTypeUpdate:
+				// a status may be edited before it's received, don't treat it as a revision then
+				st.EditedAt = nil
+			case streamEvtTypeStatusUpdate:
+				if st.EditedAt == nil {
+					t := time.Now().UTC()
+					st.EditedAt = &t
 				}
 			}
-			for _, t := range acc.Tags {
-				if strings.ToLower(t.Name) == tagNoBot {
-					return
-				}
+			pubs = m.appendStatus(ctx, pubs, i, evt.Source, st, recent)
+		case streamEvtTypeDelete:
+			stId := strings.Trim(strings.TrimSpace(string(evt.GetBinaryData())), "\"")
+			if p, ok := m.handleLiveStreamDelete(evt.Source, stId, recent); ok {
+				p.evtIdx = i
+				pubs = append(pubs, p)
 			}
+		}
+	}
+	nPub, errPub := m.publishPending(ctx, pubs)
+	n = min(n, nPub)
+	err = errors.Join(err, errPub)
+	return
+}
+
+// appendStatus handles the status at the index i of the batch, appends the event to publish if any.
+func (m mastodon) appendStatus(ctx context.Context, pubs []pending, i int, src string, st model.Status, recent map[string]indexItem) (pubsOut []pending) {
+	pubsOut = pubs
+	p, ok := m.handleLiveStreamStatus(ctx, src, st, recent)
+	if ok {
+		p.evtIdx = i
+		pubsOut = append(pubsOut, p)
+		if p.idxKey != "" {
+			recent[p.idxKey] = p.idxItem
+		}
+	}
+	return
+}
 
-			if acc.FollowersCount < m.cfg.CountMin.Followers {
-				return
+func (m mastodon) handleLiveStreamStatus(ctx context.Context, src string, st model.Status, recent map[string]indexItem) (p pending, ok bool) {
+
+	d := m.decideStatus(ctx, st)
+	// the boost is accepted, so should be the boosted status
+	var booster *model.Account
+	if d.Accepted && st.Reblog != nil {
+		acc := st.Account
+		booster = &acc
+		st = *st.Reblog
+		d = m.decideStatus(ctx, st)
+	}
+	if !d.Accepted {
+		m.log.Debug(fmt.Sprintf("live stream status %s: %s", st.Uri, d))
+		return
+	}
+
+	acc := st.Account
+	addr := acc.Url
+	if addr == "" {
+		addr = acc.Uri
+	}
+	switch {
+	case acc.Locked, booster != nil && m.cfg.Policy.Reblog == policy.ReblogFollow:
+		// able to accept the follow request manually
+		if addr == "" {
+			addr = acc.Acct
+		}
+		// the redelivery won't fix the delegation failure, the same account is likely to appear again anyway
+		if err := m.svcAp.Create(ctx, addr, groupIdDefault, addr, "", ""); err != nil {
+			m.log.Warn(fmt.Sprintf("failed to delegate following the live stream status %s author %s: %s", st.Uri, addr, err))
+		}
+	default:
+		p = pending{
+			evt:    m.convertStatus(st, addr),
+			userId: addr,
+		}
+		conversation := m.convertThread(p.evt.Attributes, st, src, recent)
+		switch {
+		case booster != nil:
+			// the same event as the boosted status has, not indexed: the boost deletion doesn't retract the status
+			boostedBy := booster.Uri
+			if boostedBy == "" {
+				boostedBy = booster.Url
 			}
-			if acc.StatusesCount < m.cfg.CountMin.Posts {
-				return
+			setUri(p.evt.Attributes, model.CeKeyBoostedBy, boostedBy)
+		case st.Id != "":
+			p.idxKey = publishedKey(src, st.Id)
+			p.idxItem = indexItem{
+				key:          statusKey(st, addr),
+				uri:          st.Uri,
+				url:          st.Url,
+				userId:       addr,
+				createdAt:    st.CreatedAt,
+				conversation: conversation,
 			}
+		}
+		ok = true
+	}
+	return
+}
 
-			addr := acc.Url
-			if addr == "" {
-				addr = acc.Uri
-			}
+func (m mastodon) handleLiveStreamDelete(src, stId string, recent map[string]indexItem) (p pending, ok bool) {
+	var item indexItem
+	item, ok = m.lookupPublished(publishedKey(src, stId), recent)
+	if ok {
+		p = pending{
+			evt:    m.convertDelete(item),
+			userId: item.userId,
+		}
+	}
+	// otherwise never published, nothing to retract
+	return
+}
+
+// publishPending publishes the events in batches per user (source account) keeping the order.
+// Returns the index of the first source event failed to publish.
+func (m mastodon) publishPending(ctx context.Context, pubs []pending) (n uint32, err error) {
+	n = math.MaxUint32
+	var userIds []string
+	batches := make(map[string][]pending)
+	for _, p := range pubs {
+		if _, exists := batches[p.userId]; !exists {
+			userIds = append(userIds, p.userId)
+		}
+		batches[p.userId] = append(batches[p.userId], p)
+	}
+	for _, userId := range userIds {
+		batch := batches[userId]
+		evts := make([]*pb.CloudEvent, len(batch))
+		for i, p := range batch {
+			evts[i] = p.evt
+		}
+		acks, errBatch := m.svcPub.PublishBatch(ctx, evts, groupIdDefault, userId)
+		if errBatch != nil {
+			err = errors.Join(err, fmt.Errorf("failed to submit the live stream events, count=%d, src=%s, err=%w", len(evts), userId, errBatch))
+		}
+		for i, p := range batch {
 			switch {
-			case acc.Locked:
-				// able to accept the follow request manually
-				if addr == "" {
-					addr = acc.Acct
-				}
-				_ = m.svcAp.Create(ctx, addr, groupIdDefault, addr, "", "")
-			case acc.Indexable == nil || *acc.Indexable == true:
-				// account allows explicitly to consume their posts
-				evtAwk := m.convertStatus(st, addr)
-				err = m.svcPub.Publish(context.TODO(), evtAwk, groupIdDefault, addr)
-				if err != nil {
-					fmt.Printf("failed to submit the live stream event, id=%s, src=%s, err=%s\n", evtAwk.Id, addr, err)
-				}
+			case i >= len(acks) || !acks[i]:
+				n = min(n, uint32(p.evtIdx))
+			case p.idxKey != "":
+				m.published.put(p.idxKey, p.idxItem)
 			}
 		}
 	}
 	return
 }
 
-func (m mastodon) convertStatus(st model.Status, src string) (evtAwk *pb.CloudEvent) {
+// lookupPublished looks for the status published either within the current batch or before.
+func (m mastodon) lookupPublished(k string, recent map[string]indexItem) (item indexItem, found bool) {
+	item, found = recent[k]
+	if !found {
+		item, found = m.published.get(k)
+	}
+	return
+}
 
-	entropy := []byte(src)
-	switch {
-	case len(entropy) < ksuidEnthropyLenMax:
-		for _ = range ksuidEnthropyLenMax - len(entropy) {
-			entropy = append(entropy, 0)
-		}
-	case len(entropy) > ksuidEnthropyLenMax:
-		entropy = entropy[:ksuidEnthropyLenMax]
+// publishedKey scopes the host-local status id by the host of the live stream source.
+func publishedKey(src, stId string) (k string) {
+	k = hostOf(src)
+	if k == "" {
+		k = src
 	}
+	k += "/" + stId
+	return
+}
 
-	t := time.Now().UTC()
-	tNanos := uint32(t.UnixNano() % int64(time.Second))
-	entropy[0] ^= byte(tNanos << 24) // most significant byte of tNanos
-	entropy[1] ^= byte(tNanos << 16)
-	entropy[2] ^= byte(tNanos << 8)
-	entropy[3] ^= byte(tNanos) // least significant byte of tNanos
+func (m mastodon) convertStatus(st model.Status, src string) (evtAwk *pb.CloudEvent) {
 
-	id, err := ksuid.FromParts(t, entropy)
-	if err != nil {
-		id = ksuid.New() // fallback
+	// the same status (or its revision) should get the same id regardless of the host or replica it's received from
+	key := statusKey(st, src)
+	t := st.CreatedAt
+	if st.EditedAt != nil {
+		key += "#" + st.EditedAt.UTC().Format(time.RFC3339Nano)
+		t = *st.EditedAt
+	}
+	id := eventId(t, key)
+
+	emojis := emojiUrls(st.Emojis)
+	subj := content.EmojiNames(st.Account.DisplayName, emojiUrls(st.Account.Emojis))
+	cw := content.EmojiNames(strings.TrimSpace(st.SpoilerText), emojis)
+	if cw != "" && m.cfg.Content.Warning.Publish {
+		subj = cw
 	}
+	txt := content.EmojiNames(content.Text(st.Content), emojis)
 
 	evtAwk = &pb.CloudEvent{
-		Id:          id.String(),
+		Id:          id,
 		Source:      src,
 		SpecVersion: model.CeSpecVersion,
 		Type:        m.typeCloudEvent,
 		Attributes: map[string]*pb.CloudEventAttributeValue{
 			model.CeKeySubject: {
 				Attr: &pb.CloudEventAttributeValue_CeString{
-					CeString: st.Account.DisplayName,
+					CeString: subj,
+				},
+			},
+			model.CeKeySensitive: {
+				Attr: &pb.CloudEventAttributeValue_CeBoolean{
+					CeBoolean: st.Sensitive,
 				},
 			},
 			model.CeKeyTime: {
@@ -299,9 +578,35 @@ func (m mastodon) convertStatus(st model.Status, src string) (evtAwk *pb.CloudEv
 			},
 		},
 		Data: &pb.CloudEvent_TextData{
-			TextData: st.Content,
+			TextData: txt,
 		},
 	}
+	if m.cfg.Content.Html && st.Content != "" {
+		evtAwk.Attributes[model.CeKeyContentHtml] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeString{
+				CeString: content.Sanitize(st.Content, emojis),
+			},
+		}
+	}
+	if st.Poll != nil {
+		txtPoll := convertPoll(evtAwk.Attributes, *st.Poll)
+		if txt != "" {
+			txtPoll = txt + "\n\n" + txtPoll
+		}
+		evtAwk.Data = &pb.CloudEvent_TextData{
+			TextData: txtPoll,
+		}
+	}
+	if st.Card != nil {
+		convertCard(evtAwk.Attributes, *st.Card)
+	}
+	if cw != "" {
+		evtAwk.Attributes[model.CeKeyContentWarning] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeString{
+				CeString: cw,
+			},
+		}
+	}
 	if st.Language != "" && len(st.Language) > 1 {
 		lang := strings.ToLower(st.Language)
 		if len(lang) > 2 {
@@ -313,6 +618,13 @@ func (m mastodon) convertStatus(st model.Status, src string) (evtAwk *pb.CloudEv
 			},
 		}
 	}
+	if st.Uri != "" {
+		evtAwk.Attributes[model.CeKeyObject] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeUri{
+				CeUri: st.Uri,
+			},
+		}
+	}
 	if st.Url != "" {
 		evtAwk.Attributes[model.CeKeyObjectUrl] = &pb.CloudEventAttributeValue{
 			Attr: &pb.CloudEventAttributeValue_CeUri{
@@ -320,6 +632,13 @@ func (m mastodon) convertStatus(st model.Status, src string) (evtAwk *pb.CloudEv
 			},
 		}
 	}
+	if st.EditedAt != nil {
+		evtAwk.Attributes[model.CeKeyRevision] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeTimestamp{
+				CeTimestamp: timestamppb.New(st.EditedAt.UTC()),
+			},
+		}
+	}
 	var cats []string
 	for _, t := range st.Tags {
 		if t.Name != "" {
@@ -333,22 +652,76 @@ func (m mastodon) convertStatus(st model.Status, src string) (evtAwk *pb.CloudEv
 			},
 		}
 	}
-	if len(st.MediaAttachments) > 0 {
-		att := st.MediaAttachments[0]
-		evtAwk.Attributes[model.CeKeyAttachmentType] = &pb.CloudEventAttributeValue{
-			Attr: &pb.CloudEventAttributeValue_CeString{
-				CeString: att.Type,
+	convertAttachments(evtAwk.Attributes, st.MediaAttachments, st.Sensitive)
+	return
+}
+
+// convertDelete produces the retraction event for the previously published status.
+func (m mastodon) convertDelete(item indexItem) (evtAwk *pb.CloudEvent) {
+	evtAwk = &pb.CloudEvent{
+		Id:          eventId(item.createdAt, item.key+"#delete"),
+		Source:      item.userId,
+		SpecVersion: model.CeSpecVersion,
+		Type:        m.typeDelete,
+		Attributes: map[string]*pb.CloudEventAttributeValue{
+			model.CeKeyTime: {
+				Attr: &pb.CloudEventAttributeValue_CeTimestamp{
+					CeTimestamp: timestamppb.New(time.Now().UTC()),
+				},
+			},
+		},
+	}
+	if item.uri != "" {
+		evtAwk.Attributes[model.CeKeyObject] = &pb.CloudEventAttributeValue{
+			Attr: &pb.CloudEventAttributeValue_CeUri{
+				CeUri: item.uri,
 			},
 		}
-		u := att.PreviewUrl
-		if u == "" {
-			u = att.Url
-		}
-		evtAwk.Attributes[model.CeKeyAttachmentUrl] = &pb.CloudEventAttributeValue{
+	}
+	if item.url != "" {
+		evtAwk.Attributes[model.CeKeyObjectUrl] = &pb.CloudEventAttributeValue{
 			Attr: &pb.CloudEventAttributeValue_CeUri{
-				CeUri: u,
+				CeUri: item.url,
 			},
 		}
 	}
 	return
 }
+
+// statusKey returns the canonical key of the status, preferably its URI.
+func statusKey(st model.Status, src string) (k string) {
+	switch {
+	case st.Uri != "":
+		k = st.Uri
+	case st.Url != "":
+		k = st.Url
+	default:
+		k = src + "#" + st.Id + "#" + st.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return
+}
+
+// eventId derives the time-sortable event id from the specified time and the hash of the specified key.
+func eventId(t time.Time, key string) string {
+	h := sha256.Sum256([]byte(key))
+	id, err := ksuid.FromParts(t, h[:ksuidPayloadLen])
+	if err != nil {
+		id = ksuid.New() // fallback
+	}
+	return id.String()
+}
+
+// emojiUrls maps the custom emoji shortcodes to the image URLs, preferring the static (not animated) ones.
+func emojiUrls(emojis []model.CustomEmoji) (urls map[string]string) {
+	if len(emojis) > 0 {
+		urls = make(map[string]string, len(emojis))
+		for _, e := range emojis {
+			u := e.StaticUrl
+			if u == "" {
+				u = e.Url
+			}
+			urls[e.Shortcode] = u
+		}
+	}
+	return
+}
@@ -0,0 +1,946 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	ap "github.com/awakari/int-mastodon/api/grpc/int-activitypub"
+	apiMastodon "github.com/awakari/int-mastodon/api/http/mastodon"
+	"github.com/awakari/int-mastodon/api/http/pub"
+	"github.com/awakari/int-mastodon/config"
+	"github.com/awakari/int-mastodon/instance"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/awakari/int-mastodon/policy"
+	"github.com/awakari/int-mastodon/storage"
+	"github.com/bytedance/sonic"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"github.com/segmentio/ksuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type pubRecorder struct {
+	lock sync.Mutex
+	evts []*pb.CloudEvent
+}
+
+func (pr *pubRecorder) Publish(ctx context.Context, evt *pb.CloudEvent, groupId, userId string) (err error) {
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	pr.evts = append(pr.evts, evt)
+	return
+}
+
+func (pr *pubRecorder) PublishBatch(ctx context.Context, evts []*pb.CloudEvent, groupId, userId string) (acks []bool, err error) {
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	pr.evts = append(pr.evts, evts...)
+	acks = make([]bool, len(evts))
+	for i := range acks {
+		acks[i] = true
+	}
+	return
+}
+
+func newTestService(svcPub *pubRecorder) Service {
+	cfg := config.MastodonConfig{}
+	cfg.Stream.IndexSize = 10
+	return NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), svcPub, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), storage.NewStorageMemory(0), slog.Default())
+}
+
+func newTestPolicy(cfg config.MastodonConfig) policy.Policy {
+	cfg.Policy.Rules = []string{
+		policy.RuleSensitive,
+		policy.RuleVisibility,
+		policy.RuleDiscoverable,
+		policy.RuleIndexable,
+		policy.RuleNoindex,
+		policy.RuleOptOut,
+		policy.RuleFollowers,
+		policy.RulePosts,
+	}
+	cfg.Policy.Visibility = []string{"public"}
+	p, err := policy.NewPolicy(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func newTestClient(cfg config.MastodonConfig) apiMastodon.Client {
+	return apiMastodon.NewClient(http.DefaultClient, "test", cfg.Endpoint.Protocol, cfg.Endpoint.Accounts, cfg.Endpoint.Search, cfg.Endpoint.Tags)
+}
+
+func newTestInstances(cfg config.MastodonConfig) instance.Service {
+	cfg.Instance.Block = []string{"blocked.host"}
+	svc, err := instance.NewService(http.DefaultClient, "test", "http://", cfg.Instance)
+	if err != nil {
+		panic(err)
+	}
+	return svc
+}
+
+func liveStreamEvent(typ, src, data string) *pb.CloudEvent {
+	return &pb.CloudEvent{
+		Id:     "evt1",
+		Source: src,
+		Type:   typ,
+		Data: &pb.CloudEvent_BinaryData{
+			BinaryData: []byte(data),
+		},
+	}
+}
+
+const testStatus = `{
+  "id": "%s",
+  "created_at": "2024-12-20T10:40:15.000Z",
+  "edited_at": %s,
+  "visibility": "public",
+  "uri": "https://host2/users/john/statuses/%s",
+  "url": "https://host2/@john/%s",
+  "content": "<p>hello</p>",
+  "account": {
+    "uri": "https://host2/users/john",
+    "url": "https://host2/@john",
+    "discoverable": true
+  }
+}`
+
+func TestMastodon_HandleLiveStreamEvents(t *testing.T) {
+	cases := map[string]struct {
+		evts     []*pb.CloudEvent
+		expected []string
+	}{
+		"update": {
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", "https://host1/api/v1/streaming/public", fmt.Sprintf(testStatus, "1", "null", "1", "1")),
+			},
+			expected: []string{"type1:https://host2/users/john/statuses/1:"},
+		},
+		"status update": {
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", "https://host1/api/v1/streaming/public", fmt.Sprintf(testStatus, "1", "null", "1", "1")),
+				liveStreamEvent("status.update", "https://host1/api/v1/streaming/public", fmt.Sprintf(testStatus, "1", `"2024-12-21T10:40:15.000Z"`, "1", "1")),
+			},
+			expected: []string{
+				"type1:https://host2/users/john/statuses/1:",
+				"type1:https://host2/users/john/statuses/1:2024-12-21 10:40:15 +0000 UTC",
+			},
+		},
+		"delete published": {
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", "https://host1/api/v1/streaming/public", fmt.Sprintf(testStatus, "1", "null", "1", "1")),
+				liveStreamEvent("delete", "https://host1/api/v1/streaming/hashtag?tag=foo", "1"),
+			},
+			expected: []string{
+				"type1:https://host2/users/john/statuses/1:",
+				"type1_delete:https://host2/users/john/statuses/1:",
+			},
+		},
+		"delete unknown": {
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", "https://host1/api/v1/streaming/public", fmt.Sprintf(testStatus, "1", "null", "1", "1")),
+				liveStreamEvent("delete", "https://host1/api/v1/streaming/public", "2"),
+				liveStreamEvent("delete", "https://host3/api/v1/streaming/public", "1"),
+			},
+			expected: []string{
+				"type1:https://host2/users/john/statuses/1:",
+			},
+		},
+		"invalid data does not stop the batch": {
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", "https://host1/api/v1/streaming/public", "{"),
+				liveStreamEvent("update", "https://host1/api/v1/streaming/public", fmt.Sprintf(testStatus, "2", "null", "2", "2")),
+			},
+			expected: []string{
+				"type1:https://host2/users/john/statuses/2:",
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			svcPub := &pubRecorder{}
+			svc := newTestService(svcPub)
+			svc.HandleLiveStreamEvents(context.TODO(), c.evts)
+			require.Equal(t, len(c.expected), len(svcPub.evts))
+			for i, evt := range svcPub.evts {
+				var rev string
+				if attrRev, present := evt.Attributes[model.CeKeyRevision]; present {
+					rev = attrRev.GetCeTimestamp().AsTime().String()
+				}
+				assert.Equal(t, c.expected[i], evt.Type+":"+evt.Attributes[model.CeKeyObject].GetCeUri()+":"+rev)
+			}
+		})
+	}
+}
+
+func TestMastodon_HandleLiveStreamEvents_Thread(t *testing.T) {
+	const src = "https://host1/api/v1/streaming/public"
+	const root = `{"id":"10","visibility":"public","uri":"https://host2/users/john/statuses/1","content":"<p>root</p>",` +
+		`"account":{"id":"100","acct":"john@host2","uri":"https://host2/users/john","discoverable":true}}`
+	const reply = `{"id":"11","visibility":"public","uri":"https://host3/users/jane/statuses/2","content":"<p>reply</p>",` +
+		`"in_reply_to_id":"10","in_reply_to_account_id":"100",` +
+		`"mentions":[{"id":"100","username":"john","acct":"john@host2","url":"https://host2/@john"}],` +
+		`"quote":{"state":"accepted","quoted_status":{"uri":"https://host4/users/jim/statuses/3"}},` +
+		`"account":{"id":"101","acct":"jane@host3","uri":"https://host3/users/jane","discoverable":true}}`
+	const replyUnknown = `{"id":"12","visibility":"public","uri":"https://host1/users/jim/statuses/4","content":"<p>reply</p>",` +
+		`"in_reply_to_id":"9","in_reply_to_account_id":"102",` +
+		`"mentions":[{"id":"102","username":"joe","acct":"joe","url":"https://host1/@joe"}],` +
+		`"account":{"id":"103","acct":"jim","uri":"https://host1/users/jim","discoverable":true}}`
+	const replyUnknownRemote = `{"id":"13","visibility":"public","uri":"https://host1/users/jim/statuses/5","content":"<p>reply</p>",` +
+		`"in_reply_to_id":"10","in_reply_to_account_id":"104",` +
+		`"mentions":[{"id":"104","username":"ann","acct":"ann@host5","url":"https://host5/@ann"}],` +
+		`"account":{"id":"103","acct":"jim","uri":"https://host1/users/jim","discoverable":true}}`
+	const boost = `{"id":"13","visibility":"public","content":"",` +
+		`"account":{"id":"104","acct":"jack@host5","uri":"https://host5/users/jack","discoverable":true},` +
+		`"reblog":{"id":"14","visibility":"public","uri":"https://host2/users/john/statuses/5","content":"<p>boosted</p>",` +
+		`"account":{"id":"100","acct":"john@host2","uri":"https://host2/users/john","url":"%s","discoverable":true}}}`
+	cases := map[string]struct {
+		reblog   string
+		evts     []*pb.CloudEvent
+		expected []map[string]string
+	}{
+		"reply to the published status": {
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", src, root),
+				liveStreamEvent("update", src, reply),
+			},
+			expected: []map[string]string{
+				{
+					model.CeKeyObject:       "https://host2/users/john/statuses/1",
+					model.CeKeyConversation: "https://host2/users/john/statuses/1",
+				},
+				{
+					model.CeKeyObject:           "https://host3/users/jane/statuses/2",
+					model.CeKeyInReplyTo:        "https://host2/users/john/statuses/1",
+					model.CeKeyInReplyToAccount: "john@host2",
+					model.CeKeyConversation:     "https://host2/users/john/statuses/1",
+					model.CeKeyQuote:            "https://host4/users/jim/statuses/3",
+				},
+			},
+		},
+		"reply to the unknown status": {
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", src, replyUnknown),
+			},
+			expected: []map[string]string{
+				{
+					model.CeKeyObject:           "https://host1/users/jim/statuses/4",
+					model.CeKeyInReplyTo:        "http://host1/@joe/9",
+					model.CeKeyInReplyToAccount: "joe@host1",
+				},
+			},
+		},
+		"reply to the unknown status of the remote account": {
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", src, replyUnknownRemote),
+			},
+			expected: []map[string]string{
+				{
+					model.CeKeyObject:           "https://host1/users/jim/statuses/5",
+					model.CeKeyInReplyTo:        "http://host1/@ann@host5/10",
+					model.CeKeyInReplyToAccount: "ann@host5",
+				},
+			},
+		},
+		"boost published": {
+			reblog: policy.ReblogPublish,
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", src, fmt.Sprintf(boost, "https://host2/@john")),
+				liveStreamEvent("delete", src, "13"),
+			},
+			expected: []map[string]string{
+				{
+					model.CeKeyObject:       "https://host2/users/john/statuses/5",
+					model.CeKeyBoostedBy:    "https://host5/users/jack",
+					model.CeKeyConversation: "https://host2/users/john/statuses/5",
+				},
+			},
+		},
+		"boost skipped": {
+			reblog: policy.ReblogSkip,
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", src, fmt.Sprintf(boost, "https://host2/@john")),
+			},
+		},
+		"boosted author followed": {
+			reblog: policy.ReblogFollow,
+			evts: []*pb.CloudEvent{
+				liveStreamEvent("update", src, fmt.Sprintf(boost, "fail")),
+			},
+			// the delegation failure doesn't fail the batch
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			svcPub := &pubRecorder{}
+			cfg := config.MastodonConfig{}
+			cfg.Stream.IndexSize = 10
+			cfg.Endpoint.Protocol = "http://"
+			cfg.Policy.Reblog = c.reblog
+			svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), svcPub, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), storage.NewStorageMemory(0), slog.Default())
+			n, err := svc.HandleLiveStreamEvents(context.TODO(), c.evts)
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(len(c.evts)), n)
+			require.Equal(t, len(c.expected), len(svcPub.evts))
+			for i, evt := range svcPub.evts {
+				assert.Equal(t, "type1", evt.Type)
+				for _, key := range []string{
+					model.CeKeyObject,
+					model.CeKeyBoostedBy,
+					model.CeKeyInReplyTo,
+					model.CeKeyInReplyToAccount,
+					model.CeKeyConversation,
+					model.CeKeyQuote,
+				} {
+					attr := evt.Attributes[key]
+					v := attr.GetCeString()
+					if v == "" {
+						v = attr.GetCeUri()
+					}
+					assert.Equal(t, c.expected[i][key], v, key)
+				}
+			}
+		})
+	}
+}
+
+func TestMastodon_convertStatus_Id(t *testing.T) {
+	svc := newTestService(&pubRecorder{}).(mastodon)
+	createdAt := time.Date(2024, 12, 20, 10, 40, 15, 0, time.UTC)
+	editedAt := createdAt.Add(time.Hour)
+	st1 := model.Status{
+		CreatedAt: createdAt,
+		Uri:       "https://host2/users/john/statuses/1",
+	}
+	id1 := svc.convertStatus(st1, "https://host2/@john").Id
+	// same status received from another host
+	assert.Equal(t, id1, svc.convertStatus(st1, "https://host3/@john@host2").Id)
+	// time-sortable by the creation time
+	ksuid1, err := ksuid.Parse(id1)
+	require.NoError(t, err)
+	assert.Equal(t, createdAt, ksuid1.Time().UTC())
+	// another status created at the same time
+	st2 := st1
+	st2.Uri = "https://host2/users/john/statuses/2"
+	assert.NotEqual(t, id1, svc.convertStatus(st2, "https://host2/@john").Id)
+	// revision of the same status
+	st1Rev := st1
+	st1Rev.EditedAt = &editedAt
+	id1Rev := svc.convertStatus(st1Rev, "https://host2/@john").Id
+	assert.NotEqual(t, id1, id1Rev)
+	assert.Equal(t, id1Rev, svc.convertStatus(st1Rev, "https://host3/@john@host2").Id)
+	assert.Greater(t, id1Rev, id1)
+	// retraction
+	idDel := svc.convertDelete(indexItem{key: st1.Uri, uri: st1.Uri, createdAt: createdAt}).Id
+	assert.NotEqual(t, id1, idDel)
+	assert.Equal(t, idDel, svc.convertDelete(indexItem{key: st1.Uri, uri: st1.Uri, createdAt: createdAt}).Id)
+}
+
+func TestMastodon_convertStatus_Content(t *testing.T) {
+	st := model.Status{
+		Uri: "https://host2/users/john/statuses/1",
+		Content: `<p>hello <a href="https://host2/tags/world" class="mention hashtag" rel="tag">#<span>world</span></a></p>` +
+			`<p><a href="https://example.com/page" onclick="x()">link</a></p>`,
+	}
+	cases := map[string]struct {
+		html     bool
+		expected string
+	}{
+		"text only": {},
+		"with html": {
+			html:     true,
+			expected: `<p>hello <a href="https://host2/tags/world" class="mention hashtag" rel="nofollow noopener noreferrer">#<span>world</span></a></p><p><a href="https://example.com/page" rel="nofollow noopener noreferrer">link</a></p>`,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			cfg := config.MastodonConfig{}
+			cfg.Content.Html = c.html
+			svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), pub.NewMock(), "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), storage.NewStorageMemory(0), slog.Default()).(mastodon)
+			evt := svc.convertStatus(st, "https://host2/@john")
+			assert.Equal(t, "hello #world\n\nlink (https://example.com/page)", evt.GetTextData())
+			assert.Equal(t, c.expected, evt.Attributes[model.CeKeyContentHtml].GetCeString())
+		})
+	}
+}
+
+func TestMastodon_convertStatus_Warning(t *testing.T) {
+	st := model.Status{
+		Uri:         "https://host2/users/john/statuses/1",
+		Sensitive:   true,
+		SpoilerText: "food ",
+		Account: model.Account{
+			DisplayName: "John",
+		},
+		MediaAttachments: []model.MediaAttachment{
+			{
+				Type:        "image",
+				Url:         "https://host2/media/1.png",
+				Description: "a sandwich",
+			},
+		},
+	}
+	cases := map[string]struct {
+		publish bool
+		subj    string
+	}{
+		"default subject": {
+			subj: "John",
+		},
+		"warning subject": {
+			publish: true,
+			subj:    "food",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			cfg := config.MastodonConfig{}
+			cfg.Content.Warning.Publish = c.publish
+			svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), pub.NewMock(), "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), storage.NewStorageMemory(0), slog.Default()).(mastodon)
+			evt := svc.convertStatus(st, "https://host2/@john")
+			assert.Equal(t, c.subj, evt.Attributes[model.CeKeySubject].GetCeString())
+			assert.Equal(t, "food", evt.Attributes[model.CeKeyContentWarning].GetCeString())
+			assert.True(t, evt.Attributes[model.CeKeySensitive].GetCeBoolean())
+			assert.Equal(t, "a sandwich", evt.Attributes[model.CeKeyAttachmentDescription].GetCeString())
+			assert.True(t, evt.Attributes[model.CeKeyAttachmentSensitive].GetCeBoolean())
+		})
+	}
+}
+
+func TestMastodon_convertStatus_PollCardEmojis(t *testing.T) {
+	var st model.Status
+	err := sonic.Unmarshal([]byte(`{
+  "id": "103270115826048975",
+  "created_at": "2019-12-08T03:48:33.901Z",
+  "uri": "https://host2/users/john/statuses/103270115826048975",
+  "content": "<p>Which one :blobcat:?</p>",
+  "account": {
+    "display_name": "John :verified:",
+    "emojis": [{"shortcode": "verified", "url": "https://host2/emojis/verified.gif", "static_url": "https://host2/emojis/verified.png"}]
+  },
+  "emojis": [{"shortcode": "blobcat", "url": "https://host2/emojis/blobcat.png", "static_url": "https://host2/emojis/blobcat.png"}],
+  "poll": {
+    "id": "34830",
+    "expires_at": "2019-12-05T04:05:08.302Z",
+    "expired": true,
+    "multiple": false,
+    "votes_count": 10,
+    "voters_count": null,
+    "options": [
+      {"title": "accept :ablobfox:", "votes_count": 6},
+      {"title": "deny", "votes_count": 4}
+    ],
+    "emojis": [{"shortcode": "ablobfox", "url": "https://host2/emojis/ablobfox.png", "static_url": "https://host2/emojis/ablobfox.png"}]
+  },
+  "card": {
+    "url": "https://www.youtube.com/watch?v=OMv_EPMED8Y",
+    "title": "♪ Brand New Friend (Christmas Song!)",
+    "description": "",
+    "type": "video",
+    "author_name": "YOGSCAST Lewis & Simon",
+    "provider_name": "YouTube",
+    "html": "<iframe width=\"480\" height=\"270\" src=\"https://www.youtube.com/embed/OMv_EPMED8Y\"></iframe>",
+    "width": 480,
+    "height": 270,
+    "image": "https://host2/preview_cards/images/014/179/145/original/9cf4b7cf5567b569.jpeg",
+    "embed_url": ""
+  }
+}`), &st)
+	require.NoError(t, err)
+	cfg := config.MastodonConfig{}
+	cfg.Content.Html = true
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), pub.NewMock(), "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), storage.NewStorageMemory(0), slog.Default()).(mastodon)
+	evt := svc.convertStatus(st, "https://host2/@john")
+	assert.Equal(t, "John verified", evt.Attributes[model.CeKeySubject].GetCeString())
+	assert.Equal(t, "Which one blobcat?\n\nPoll, 10 votes, ended 2019-12-05T04:05:08Z:\n- accept ablobfox: 6\n- deny: 4", evt.GetTextData())
+	assert.Equal(t, `<p>Which one <img src="https://host2/emojis/blobcat.png" alt=":blobcat:" class="custom-emoji">?</p>`, evt.Attributes[model.CeKeyContentHtml].GetCeString())
+	// poll
+	assert.Equal(t, int32(10), evt.Attributes[model.CeKeyPollVotes].GetCeInteger())
+	assert.False(t, evt.Attributes[model.CeKeyPollMultiple].GetCeBoolean())
+	assert.Equal(t, time.Date(2019, 12, 5, 4, 5, 8, 302_000_000, time.UTC), evt.Attributes[model.CeKeyPollExpires].GetCeTimestamp().AsTime())
+	assert.Equal(t, "accept ablobfox", evt.Attributes[model.CeKeyPollOption(0)].GetCeString())
+	assert.Equal(t, int32(6), evt.Attributes[model.CeKeyPollOptionVotes(0)].GetCeInteger())
+	assert.Equal(t, "deny", evt.Attributes[model.CeKeyPollOption(1)].GetCeString())
+	assert.Equal(t, int32(4), evt.Attributes[model.CeKeyPollOptionVotes(1)].GetCeInteger())
+	// card
+	assert.Equal(t, "♪ Brand New Friend (Christmas Song!)", evt.Attributes[model.CeKeyCardTitle].GetCeString())
+	assert.NotContains(t, evt.Attributes, model.CeKeyCardDescription)
+	assert.Equal(t, "YouTube", evt.Attributes[model.CeKeyCardProvider].GetCeString())
+	assert.Equal(t, "https://www.youtube.com/watch?v=OMv_EPMED8Y", evt.Attributes[model.CeKeyCardUrl].GetCeUri())
+	assert.Equal(t, "https://host2/preview_cards/images/014/179/145/original/9cf4b7cf5567b569.jpeg", evt.Attributes[model.CeKeyCardImage].GetCeUri())
+	for k := range evt.Attributes {
+		assert.LessOrEqual(t, len(k), model.CeKeyLenMax, k)
+	}
+}
+
+func TestConvertPoll_HiddenVotes(t *testing.T) {
+	attrs := map[string]*pb.CloudEventAttributeValue{}
+	txt := convertPoll(attrs, model.Poll{
+		Multiple: true,
+		Options: []model.PollOption{
+			{Title: "a"},
+			{Title: "b"},
+		},
+	})
+	assert.Equal(t, "Poll (multiple choice), 0 votes:\n- a\n- b", txt)
+	assert.NotContains(t, attrs, model.CeKeyPollExpires)
+	assert.NotContains(t, attrs, model.CeKeyPollOptionVotes(0))
+	assert.True(t, attrs[model.CeKeyPollMultiple].GetCeBoolean())
+}
+
+func TestConvertAttachments(t *testing.T) {
+	var atts []model.MediaAttachment
+	err := sonic.Unmarshal([]byte(`[
+  {
+    "id": "22345792",
+    "type": "image",
+    "url": "https://files.host2/media_attachments/files/022/345/792/original/57859aede991da25.jpeg",
+    "preview_url": "https://files.host2/media_attachments/files/022/345/792/small/57859aede991da25.jpeg",
+    "remote_url": null,
+    "text_url": "https://host2/media/2N4uvkuUtPVrkZGysms",
+    "meta": {
+      "original": {"width": 640, "height": 480, "size": "640x480", "aspect": 1.3333333333333333},
+      "small": {"width": 461, "height": 346, "size": "461x346", "aspect": 1.3323699421965318},
+      "focus": {"x": -0.27, "y": 0.51}
+    },
+    "description": "test media description",
+    "blurhash": "UFBWY:8_0Jxv4mx]t8t64.%M-:IUWGWAt6M}"
+  },
+  {
+    "id": "21165404",
+    "type": "audio",
+    "url": "https://files.host3/media_attachments/files/021/165/404/original/a7e0e6c5cd0d8cd5.mp3",
+    "preview_url": null,
+    "remote_url": "https://host3/media/a7e0e6c5cd0d8cd5.mp3",
+    "meta": {
+      "length": "0:06:42.86",
+      "duration": 402.86,
+      "audio_encode": "mp3",
+      "original": {"duration": 402.860408, "bitrate": 166290}
+    },
+    "description": null,
+    "blurhash": null
+  }
+]`), &atts)
+	require.NoError(t, err)
+	attrs := map[string]*pb.CloudEventAttributeValue{}
+	convertAttachments(attrs, atts, true)
+	assert.Equal(t, int32(2), attrs[model.CeKeyAttachmentCount].GetCeInteger())
+	// first one
+	assert.Equal(t, "image", attrs[model.CeKeyAttachmentType].GetCeString())
+	assert.Equal(t, atts[0].PreviewUrl, attrs[model.CeKeyAttachmentUrl].GetCeUri())
+	assert.Equal(t, "test media description", attrs[model.CeKeyAttachmentDescription].GetCeString())
+	assert.True(t, attrs[model.CeKeyAttachmentSensitive].GetCeBoolean())
+	// every one
+	assert.Equal(t, "image", attrs["att0type"].GetCeString())
+	assert.Equal(t, atts[0].Url, attrs["att0url"].GetCeUri())
+	assert.Equal(t, atts[0].PreviewUrl, attrs["att0previewurl"].GetCeUri())
+	assert.NotContains(t, attrs, "att0remoteurl")
+	assert.Equal(t, "test media description", attrs["att0description"].GetCeString())
+	assert.Equal(t, int32(640), attrs["att0width"].GetCeInteger())
+	assert.Equal(t, int32(480), attrs["att0height"].GetCeInteger())
+	assert.NotContains(t, attrs, "att0duration")
+	assert.Equal(t, "UFBWY:8_0Jxv4mx]t8t64.%M-:IUWGWAt6M}", attrs["att0blurhash"].GetCeString())
+	assert.Equal(t, "audio", attrs["att1type"].GetCeString())
+	assert.Equal(t, "https://host3/media/a7e0e6c5cd0d8cd5.mp3", attrs["att1remoteurl"].GetCeUri())
+	assert.NotContains(t, attrs, "att1previewurl")
+	assert.NotContains(t, attrs, "att1description")
+	assert.NotContains(t, attrs, "att1width")
+	assert.Equal(t, int32(403), attrs["att1duration"].GetCeInteger())
+	for k := range attrs {
+		assert.LessOrEqual(t, len(k), model.CeKeyLenMax, k)
+	}
+	// none
+	attrs = map[string]*pb.CloudEventAttributeValue{}
+	convertAttachments(attrs, nil, true)
+	assert.Empty(t, attrs)
+}
+
+func TestMastodon_HandleLiveStreamEvents_Count(t *testing.T) {
+	cfg := config.MastodonConfig{}
+	cfg.Stream.IndexSize = 10
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), pub.NewMock(), "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), storage.NewStorageMemory(0), slog.Default())
+	stNoAck := strings.Replace(fmt.Sprintf(testStatus, "2", "null", "2", "2"), `"url": "https://host2/@john",`, `"url": "noack",`, 1)
+	evts := []*pb.CloudEvent{
+		liveStreamEvent("update", "https://host1/api/v1/streaming/public", fmt.Sprintf(testStatus, "1", "null", "1", "1")),
+		liveStreamEvent("update", "https://host1/api/v1/streaming/public", "{"),
+		liveStreamEvent("update", "https://host1/api/v1/streaming/public", stNoAck),
+		liveStreamEvent("update", "https://host1/api/v1/streaming/public", fmt.Sprintf(testStatus, "3", "null", "3", "3")),
+	}
+	n, err := svc.HandleLiveStreamEvents(context.TODO(), evts)
+	assert.ErrorIs(t, err, pub.ErrNoAck)
+	assert.Equal(t, uint32(2), n)
+	n, err = svc.HandleLiveStreamEvents(context.TODO(), evts[3:])
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), n)
+}
+
+func TestMastodon_RemoveSources(t *testing.T) {
+	var unfollowed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v2/search" && r.URL.Query().Get("q") == "interest1@ap.host":
+			assert.Equal(t, "false", r.URL.Query().Get("resolve"))
+			_, _ = w.Write([]byte(`{"accounts":[{"id":"42","acct":"interest1@ap.host"}]}`))
+		case r.URL.Path == "/api/v2/search":
+			_, _ = w.Write([]byte(`{"accounts":[{"id":"43","acct":"interest2@another.host"}]}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/unfollow"):
+			unfollowed = append(unfollowed, r.URL.Path)
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	cfg := config.MastodonConfig{}
+	cfg.Client.Hosts = []string{strings.TrimPrefix(srv.URL, "http://")}
+	cfg.Client.Tokens = []string{"token1"}
+	cfg.Endpoint.Protocol = "http://"
+	cfg.Endpoint.Search = "/api/v2/search"
+	cfg.Endpoint.Accounts = "/api/v1/accounts"
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), &pubRecorder{}, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), storage.NewStorageMemory(0), slog.Default()).(mastodon)
+	//
+	n, err := svc.RemoveSources(context.TODO(), "interest1", "group1", "interest1@ap.host", model.SearchTypeAccounts)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), n)
+	assert.Equal(t, []string{"/api/v1/accounts/42/unfollow"}, unfollowed)
+	n, err = svc.RemoveSources(context.TODO(), "interest2", "group1", "interest2@ap.host", model.SearchTypeAccounts)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), n)
+	assert.Len(t, unfollowed, 1)
+	//
+	for _, src := range []model.Source{
+		{
+			AccountUri: "https://host2/users/john",
+			InterestId: "interest1",
+			Outcome:    model.SourceOutcomeDelegated,
+		},
+		{
+			AccountUri: "https://host2/users/jane",
+			InterestId: "interest1",
+			Outcome:    model.SourceOutcomeDelegated,
+		},
+		{
+			AccountUri: "https://host2/users/jim",
+			InterestId: "interest1",
+			Outcome:    model.SourceOutcomeRejected,
+		},
+		{
+			AccountUri: "https://host2/users/john",
+			InterestId: "interest2",
+			Outcome:    model.SourceOutcomeDelegated,
+		},
+		{
+			AccountUri: "https://host2/users/jane",
+			InterestId: "fail",
+			Outcome:    model.SourceOutcomeDelegated,
+		},
+	} {
+		require.NoError(t, svc.stor.Put(context.TODO(), src))
+	}
+	n, err = svc.RemoveSources(context.TODO(), "interest1", "group1", "", model.SearchTypeStatuses)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), n)
+	// nothing left locally, e.g. added by another replica, int-activitypub deletes by the interest anyway
+	n, err = svc.RemoveSources(context.TODO(), "interest1", "group1", "", model.SearchTypeStatuses)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), n)
+	// the failed one is retried
+	n, err = svc.RemoveSources(context.TODO(), "fail", "group1", "", model.SearchTypeStatuses)
+	assert.ErrorIs(t, err, ap.ErrInternal)
+	assert.Equal(t, uint32(0), n)
+	srcs, err := svc.stor.List(context.TODO(), model.SourceFilter{})
+	require.NoError(t, err)
+	require.Len(t, srcs, 2)
+	assert.ElementsMatch(t, []string{"interest2", "fail"}, []string{srcs[0].InterestId, srcs[1].InterestId})
+	n, err = svc.RemoveSources(context.TODO(), "interest2", "group1", "", model.SearchTypeStatuses)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), n)
+}
+
+func TestMastodon_RemoveSources_HostHung(t *testing.T) {
+	hung := make(chan struct{})
+	srvHung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hung
+	}))
+	defer srvHung.Close()
+	defer close(hung)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v2/search":
+			_, _ = w.Write([]byte(`{"accounts":[{"id":"42","acct":"interest1@ap.host"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/unfollow"):
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	cfg := config.MastodonConfig{}
+	cfg.Client.Hosts = []string{strings.TrimPrefix(srvHung.URL, "http://"), strings.TrimPrefix(srv.URL, "http://")}
+	cfg.Client.Tokens = []string{"token1", "token2"}
+	cfg.Endpoint.Protocol = "http://"
+	cfg.Endpoint.Search = "/api/v2/search"
+	cfg.Endpoint.Accounts = "/api/v1/accounts"
+	cfg.Search.Concurrency = 2
+	cfg.Search.Timeout = 100 * time.Millisecond
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), &pubRecorder{}, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), storage.NewStorageMemory(0), slog.Default())
+	start := time.Now()
+	n, err := svc.RemoveSources(context.TODO(), "interest1", "group1", "interest1@ap.host", model.SearchTypeAccounts)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, uint32(1), n)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestMastodon_processFoundAccount(t *testing.T) {
+	svc := newTestService(&pubRecorder{}).(mastodon)
+	indexable := false
+	cases := []struct {
+		acc      model.Account
+		delegate bool
+		outcome  model.SourceOutcome
+		decision model.Decision
+		errStr   string
+		err      error
+	}{
+		{
+			acc: model.Account{
+				Uri:          "https://host2/users/john",
+				Discoverable: true,
+			},
+			delegate: true,
+			outcome:  model.SourceOutcomeDelegated,
+			decision: model.Accept(),
+		},
+		{
+			acc: model.Account{
+				Uri:          "https://host2/users/jane",
+				Discoverable: true,
+				Indexable:    &indexable,
+			},
+			delegate: true,
+			outcome:  model.SourceOutcomeRejected,
+			decision: model.Reject(model.ReasonNotIndexable, "indexable flag is false"),
+		},
+		{
+			acc: model.Account{
+				Acct:         "jim@blocked.host",
+				Uri:          "https://social.blocked.host/users/jim",
+				Discoverable: true,
+			},
+			delegate: true,
+			outcome:  model.SourceOutcomeRejected,
+			decision: model.Reject(model.ReasonInstanceBlocked, "domain blocked.host is blocked by blocked.host"),
+		},
+		{
+			acc: model.Account{
+				Uri:          "fail",
+				Discoverable: true,
+			},
+			delegate: true,
+			outcome:  model.SourceOutcomeFailed,
+			decision: model.Accept(),
+			errStr:   "internal failure",
+			err:      ap.ErrInternal,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.acc.Uri, func(t *testing.T) {
+			err := svc.processFoundAccount(context.TODO(), "host1", "token1", c.acc, "interest1", "group1", "q1", c.delegate)
+			assert.ErrorIs(t, err, c.err)
+			srcs, err := svc.stor.List(context.TODO(), model.SourceFilter{AccountUri: c.acc.Uri})
+			require.NoError(t, err)
+			require.Len(t, srcs, 1)
+			assert.Equal(t, "host1", srcs[0].Host)
+			assert.Equal(t, "interest1", srcs[0].InterestId)
+			assert.Equal(t, "group1", srcs[0].GroupId)
+			assert.Equal(t, "q1", srcs[0].Query)
+			assert.Equal(t, c.outcome, srcs[0].Outcome)
+			assert.Equal(t, c.decision, srcs[0].Decision)
+			assert.Equal(t, c.errStr, srcs[0].Error)
+		})
+	}
+	// already delegated account found on another host is skipped
+	srcs, err := svc.stor.List(context.TODO(), model.SourceFilter{AccountUri: "https://host2/users/john"})
+	require.NoError(t, err)
+	err = svc.processFoundAccount(context.TODO(), "host3", "token3", model.Account{Uri: "https://host2/users/john"}, "interest1", "group1", "q2", true)
+	assert.NoError(t, err)
+	srcsAfter, err := svc.stor.List(context.TODO(), model.SourceFilter{AccountUri: "https://host2/users/john"})
+	require.NoError(t, err)
+	assert.Equal(t, srcs, srcsAfter)
+}
+
+func TestMastodon_processFoundAccount_CountMin(t *testing.T) {
+	cfg := config.MastodonConfig{}
+	cfg.CountMin.Followers = 10
+	cfg.CountMin.Posts = 100
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), &pubRecorder{}, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), storage.NewStorageMemory(0), slog.Default()).(mastodon)
+	acc := model.Account{
+		Uri:            "https://host2/users/john",
+		Discoverable:   true,
+		FollowersCount: 9,
+		StatusesCount:  100,
+	}
+	err := svc.processFoundAccount(context.TODO(), "host1", "token1", acc, "interest1", "group1", "q1", true)
+	require.NoError(t, err)
+	srcs, err := svc.stor.List(context.TODO(), model.SourceFilter{AccountUri: acc.Uri})
+	require.NoError(t, err)
+	require.Len(t, srcs, 1)
+	assert.Equal(t, model.SourceOutcomeRejected, srcs[0].Outcome)
+	assert.Equal(t, model.ReasonLowFollowers, srcs[0].Decision.Reason)
+}
+
+func TestMastodon_Search(t *testing.T) {
+	var followed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v2/search" && r.URL.Query().Get("offset") == "0":
+			assert.Equal(t, "statuses", r.URL.Query().Get("type"))
+			_, _ = w.Write([]byte(`{"statuses":[` +
+				`{"uri":"https://host2/users/john/statuses/1","visibility":"public","account":{"uri":"https://host2/users/john","discoverable":true}},` +
+				`{"uri":"https://host2/users/jane/statuses/2","visibility":"public","sensitive":true,"account":{"uri":"https://host2/users/jane","discoverable":true}},` +
+				`{"uri":"https://host2/users/jim/statuses/3","visibility":"public","account":{"uri":"https://host2/users/jim","noindex":true}}` +
+				`]}`))
+		case r.URL.Path == "/api/v2/search":
+			_, _ = w.Write([]byte(`{"statuses":[]}`))
+		default:
+			followed = append(followed, r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+	cfg := config.MastodonConfig{}
+	cfg.Client.Hosts = []string{strings.TrimPrefix(srv.URL, "http://")}
+	cfg.Client.Tokens = []string{"token1"}
+	cfg.Endpoint.Protocol = "http://"
+	cfg.Endpoint.Search = "/api/v2/search"
+	stor := storage.NewStorageMemory(0)
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), &pubRecorder{}, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), stor, slog.Default())
+	candidates, err := svc.Search(context.TODO(), "foo", 10, model.SearchTypeStatuses)
+	require.NoError(t, err)
+	require.Len(t, candidates, 3)
+	assert.Equal(t, model.Candidate{
+		AccountUri: "https://host2/users/john",
+		StatusUri:  "https://host2/users/john/statuses/1",
+		Host:       cfg.Client.Hosts[0],
+		Decision:   model.Accept(),
+	}, candidates[0])
+	assert.Equal(t, model.Reject(model.ReasonSensitive, "status is marked sensitive"), candidates[1].Decision)
+	assert.Equal(t, model.Reject(model.ReasonNotDiscoverable, "no explicit discoverable flag set"), candidates[2].Decision)
+	// dry run: nothing added
+	assert.Empty(t, followed)
+	srcs, err := stor.List(context.TODO(), model.SourceFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, srcs)
+}
+
+func TestMastodon_Search_Hosts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("offset") {
+		case "0":
+			// same status of the account from the "localhost" instance found on every host
+			_, _ = w.Write([]byte(`{"statuses":[` +
+				`{"uri":"https://localhost/users/john/statuses/1","visibility":"public","account":{"uri":"https://localhost/users/john","discoverable":true}},` +
+				`{"uri":"https://host2/users/jane/statuses/2","visibility":"public","account":{"uri":"https://host2/users/jane","discoverable":true}}` +
+				`]}`))
+		default:
+			_, _ = w.Write([]byte(`{"statuses":[]}`))
+		}
+	}))
+	defer srv.Close()
+	srvSlow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer srvSlow.Close()
+	_, port, _ := strings.Cut(strings.TrimPrefix(srv.URL, "http://"), ":")
+	cfg := config.MastodonConfig{}
+	cfg.Client.Hosts = []string{
+		"127.0.0.1:" + port,
+		strings.TrimPrefix(srvSlow.URL, "http://"),
+		"localhost:" + port,
+	}
+	cfg.Client.Tokens = []string{"token1", "token2", "token3"}
+	cfg.Endpoint.Protocol = "http://"
+	cfg.Endpoint.Search = "/api/v2/search"
+	cfg.Search.Concurrency = 2
+	cfg.Search.Timeout = 100 * time.Millisecond
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), &pubRecorder{}, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), storage.NewStorageMemory(0), slog.Default())
+	t0 := time.Now()
+	candidates, err := svc.Search(context.TODO(), "foo", 10, model.SearchTypeStatuses)
+	assert.Less(t, time.Since(t0), 5*time.Second)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, candidates, 2)
+	// the account home host is preferred
+	assert.Equal(t, "https://localhost/users/john/statuses/1", candidates[0].StatusUri)
+	assert.Equal(t, cfg.Client.Hosts[2], candidates[0].Host)
+	assert.Equal(t, "https://host2/users/jane/statuses/2", candidates[1].StatusUri)
+	assert.Equal(t, cfg.Client.Hosts[0], candidates[1].Host)
+}
+
+func TestMastodon_SearchAndAdd_Cursor(t *testing.T) {
+	var reqs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		reqs = append(reqs, q.Get("q")+" min_id="+q.Get("min_id")+" max_id="+q.Get("max_id"))
+		st := func(id string) string {
+			return `{"id":"` + id + `","uri":"https://host2/users/john/statuses/` + id + `","visibility":"public","sensitive":true,"account":{"uri":"https://host2/users/john","discoverable":true}}`
+		}
+		switch {
+		case q.Get("q") == "stuck":
+			// ignores the cursor
+			_, _ = w.Write([]byte(`{"statuses":[` + st("30") + `,` + st("20") + `]}`))
+		case q.Get("min_id") == "30":
+			_, _ = w.Write([]byte(`{"statuses":[]}`))
+		case q.Get("max_id") == "":
+			_, _ = w.Write([]byte(`{"statuses":[` + st("30") + `,` + st("20") + `]}`))
+		case q.Get("max_id") == "20":
+			_, _ = w.Write([]byte(`{"statuses":[` + st("10") + `]}`))
+		default:
+			_, _ = w.Write([]byte(`{"statuses":[]}`))
+		}
+	}))
+	defer srv.Close()
+	cfg := config.MastodonConfig{}
+	cfg.Client.Hosts = []string{strings.TrimPrefix(srv.URL, "http://")}
+	cfg.Client.Tokens = []string{"token1"}
+	cfg.Endpoint.Protocol = "http://"
+	cfg.Endpoint.Search = "/api/v2/search"
+	cfg.Search.PagesMax = 10
+	stor := storage.NewStorageMemory(0)
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), &pubRecorder{}, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), stor, slog.Default())
+	n, err := svc.SearchAndAdd(context.TODO(), "interest1", "group1", "foo", 10, model.SearchTypeStatuses)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), n)
+	assert.Equal(t, []string{"foo min_id= max_id=", "foo min_id= max_id=20", "foo min_id= max_id=10"}, reqs)
+	id, err := stor.Cursor(context.TODO(), cfg.Client.Hosts[0], "search/interest1/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "30", id)
+	// the next run fetches the new statuses only
+	reqs = nil
+	n, err = svc.SearchAndAdd(context.TODO(), "interest1", "group1", "foo", 10, model.SearchTypeStatuses)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), n)
+	assert.Equal(t, []string{"foo min_id=30 max_id="}, reqs)
+	// the removal forgets the cursor
+	_, err = svc.RemoveSources(context.TODO(), "interest1", "group1", "", model.SearchTypeStatuses)
+	require.NoError(t, err)
+	id, err = stor.Cursor(context.TODO(), cfg.Client.Hosts[0], "search/interest1/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "", id)
+	// the same page again stops the paging
+	reqs = nil
+	n, err = svc.SearchAndAdd(context.TODO(), "interest2", "group1", "stuck", 10, model.SearchTypeStatuses)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), n)
+	assert.Equal(t, []string{"stuck min_id= max_id=", "stuck min_id= max_id=20"}, reqs)
+}
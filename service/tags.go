@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	apiMastodon "github.com/awakari/int-mastodon/api/http/mastodon"
+	"github.com/awakari/int-mastodon/model"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+func (m mastodon) FollowTags(ctx context.Context, interestId string, queries []string) (tags []string, err error) {
+	tags = tagsOf(queries)
+	// the concurrent changes would see each other's intermediate state and miss the hashtags not followed anymore
+	m.tagsLock.Lock()
+	defer m.tagsLock.Unlock()
+	var tagsBefore []string
+	tagsBefore, err = m.stor.ListTags(ctx)
+	if err == nil {
+		err = m.stor.PutTags(ctx, model.InterestTags{
+			InterestId: interestId,
+			Tags:       tags,
+		})
+	}
+	var tagsAfter []string
+	if err == nil {
+		tagsAfter, err = m.stor.ListTags(ctx)
+	}
+	if err == nil {
+		// not followed by any interest anymore, start from the newest statuses when followed again
+		for _, tag := range tagsBefore {
+			if !slices.Contains(tagsAfter, tag) {
+				err = errors.Join(err, m.stor.DeleteCursors(ctx, cursorKeyTag(tag)))
+			}
+		}
+	}
+	return
+}
+
+func (m mastodon) PollTags(ctx context.Context) (n uint32, err error) {
+	var tags []string
+	tags, err = m.stor.ListTags(ctx)
+	if err == nil {
+		for i, host := range m.cfg.Client.Hosts {
+			for _, tag := range tags {
+				nTag, errTag := m.pollTag(ctx, host, m.cfg.Client.Tokens[i], tag)
+				n += nTag
+				if errTag != nil {
+					err = errors.Join(err, fmt.Errorf("failed to poll the hashtag %s on %s: %w", tag, host, errTag))
+				}
+			}
+		}
+	}
+	return
+}
+
+// pollTag handles the statuses newer than the hashtag cursor on the host, the oldest first like the live stream does.
+// The cursor moves to the last status handled successfully, so the rest is fetched again on the next poll.
+func (m mastodon) pollTag(ctx context.Context, host, tokAuth, tag string) (n uint32, err error) {
+	k := cursorKeyTag(tag)
+	var sinceId string
+	sinceId, err = m.stor.Cursor(ctx, host, k)
+	var sts []model.Status
+	var errFetch error
+	if err == nil {
+		// handle the statuses fetched before the failure, if any
+		sts, errFetch = m.fetchTag(ctx, host, tokAuth, tag, sinceId)
+	}
+	if err == nil && len(sts) > 0 {
+		src := m.cfg.Endpoint.Protocol + host + m.cfg.Endpoint.Tags + "/" + url.PathEscape(tag)
+		n = uint32(len(sts))
+		var pubs []pending
+		recent := make(map[string]indexItem)
+		for i, st := range sts {
+			// the edited status is not a revision unless it's seen before, same as the live stream "update"
+			st.EditedAt = nil
+			pubs = m.appendStatus(ctx, pubs, i, src, st, recent)
+		}
+		nPub, errPub := m.publishPending(ctx, pubs)
+		n = min(n, nPub)
+		err = errors.Join(err, errPub)
+		if n > 0 {
+			err = errors.Join(err, m.stor.PutCursor(ctx, model.Cursor{
+				Host: host,
+				Key:  k,
+				Id:   sts[n-1].Id,
+			}))
+		}
+	}
+	err = errors.Join(err, errFetch)
+	return
+}
+
+// fetchTag returns the hashtag statuses newer than the sinceId, the oldest first. Pages up from the sinceId by the
+// min_id cursor within the page count limit, so there's no gap when the limit is reached or the fetch fails: the rest
+// is fetched on the next poll. Only the first page of the newest statuses is fetched when the sinceId is unknown.
+// On failure, returns the statuses of the pages fetched before along with the error.
+func (m mastodon) fetchTag(ctx context.Context, host, tokAuth, tag, sinceId string) (sts []model.Status, err error) {
+	if m.cfg.Tags.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.cfg.Tags.Timeout)
+		defer cancel()
+	}
+	page := apiMastodon.Page{
+		MinId: sinceId,
+		Limit: m.cfg.Tags.Limit,
+	}
+	pagesMax := max(1, m.cfg.Tags.PagesMax)
+	for pages := uint32(0); pages < pagesMax; pages++ {
+		var pageSts []model.Status
+		var links apiMastodon.Links
+		pageSts, links, err = m.client.TagTimeline(ctx, host, tokAuth, tag, page)
+		if err != nil {
+			break
+		}
+		// the newest first within the page
+		slices.Reverse(pageSts)
+		for _, st := range pageSts {
+			// the server may ignore the cursor
+			if model.IdNewer(st.Id, sinceId) {
+				sts = append(sts, st)
+				sinceId = st.Id
+			}
+		}
+		// the last page is not full
+		if page.MinId == "" || uint32(len(pageSts)) < page.Limit || links.Prev.MinId == "" || links.Prev.MinId == page.MinId {
+			break
+		}
+		page.MinId = links.Prev.MinId
+	}
+	return
+}
+
+// cursorKeyTag identifies the hashtag cursors, the trailing slash keeps the key prefix deletion exact.
+func cursorKeyTag(tag string) string {
+	return "tag/" + tag + "/"
+}
+
+// tagsOf finds the hashtags in the queries, i.e. the words starting with "#", e.g. "#Go" is the hashtag "go".
+// The hashtag is the letters, digits and underscores, not only digits.
+func tagsOf(queries []string) (tags []string) {
+	for _, q := range queries {
+		for _, w := range strings.Fields(q) {
+			if !strings.HasPrefix(w, "#") {
+				continue
+			}
+			w = strings.TrimRightFunc(strings.TrimPrefix(w, "#"), unicode.IsPunct)
+			if isTag(w) {
+				tags = append(tags, strings.ToLower(w))
+			}
+		}
+	}
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+	return
+}
+
+func isTag(w string) (ok bool) {
+	for _, r := range w {
+		switch {
+		case unicode.IsLetter(r), r == '_':
+			ok = true
+		case unicode.IsDigit(r):
+		default:
+			return false
+		}
+	}
+	return
+}
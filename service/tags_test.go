@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	ap "github.com/awakari/int-mastodon/api/grpc/int-activitypub"
+	"github.com/awakari/int-mastodon/config"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/awakari/int-mastodon/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTagsOf(t *testing.T) {
+	cases := map[string]struct {
+		queries []string
+		tags    []string
+	}{
+		"none": {},
+		"hashtags": {
+			queries: []string{"#Go rocks, #café!", "more #go"},
+			tags:    []string{"café", "go"},
+		},
+		"no hashtags": {
+			queries: []string{"golang", "  Fediverse  ", "two words"},
+		},
+		"invalid": {
+			queries: []string{"#2024", "#", "#foo-bar", "a.b"},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.tags, tagsOf(c.queries))
+		})
+	}
+}
+
+func TestMastodon_PollTags(t *testing.T) {
+	var reqs []string
+	st := func(id string, sensitive bool) string {
+		s := `{"id":"` + id + `","visibility":"public","uri":"https://host2/users/john/statuses/` + id + `","content":"<p>#go</p>",`
+		if sensitive {
+			s += `"sensitive":true,`
+		}
+		return s + `"account":{"id":"100","acct":"john@host2","uri":"https://host2/users/john","discoverable":true}}`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		minId := r.URL.Query().Get("min_id")
+		reqs = append(reqs, r.URL.Path+" min_id="+minId)
+		link := func(minId string) {
+			w.Header().Set("Link", `<http://`+r.Host+r.URL.Path+`?min_id=`+minId+`>; rel="prev"`)
+		}
+		switch {
+		case r.URL.Path != "/api/v1/timelines/tag/go":
+			_, _ = w.Write([]byte(`[]`))
+		case minId == "":
+			link("30")
+			_, _ = w.Write([]byte(`[` + st("30", false) + `,` + st("20", false) + `]`))
+		case minId == "30":
+			link("32")
+			_, _ = w.Write([]byte(`[` + st("32", false) + `,` + st("31", true) + `]`))
+		default:
+			_, _ = w.Write([]byte(`[]`))
+		}
+	}))
+	defer srv.Close()
+	cfg := config.MastodonConfig{}
+	cfg.Client.Hosts = []string{strings.TrimPrefix(srv.URL, "http://")}
+	cfg.Client.Tokens = []string{"token1"}
+	cfg.Endpoint.Protocol = "http://"
+	cfg.Endpoint.Tags = "/api/v1/timelines/tag"
+	cfg.Stream.IndexSize = 10
+	cfg.Tags.Limit = 2
+	cfg.Tags.PagesMax = 5
+	svcPub := &pubRecorder{}
+	stor := storage.NewStorageMemory(0)
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), svcPub, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), stor, slog.Default())
+	tags, err := svc.FollowTags(context.TODO(), "interest1", []string{"#Go news", "#golang", "fediverse"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "golang"}, tags)
+	objects := func() (objs []string) {
+		for _, evt := range svcPub.evts {
+			objs = append(objs, evt.Attributes[model.CeKeyObject].GetCeUri())
+		}
+		svcPub.evts = nil
+		return
+	}
+	// the first poll takes the newest page only
+	n, err := svc.PollTags(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), n)
+	assert.Equal(t, []string{"/api/v1/timelines/tag/go min_id=", "/api/v1/timelines/tag/golang min_id="}, reqs)
+	assert.Equal(t, []string{"https://host2/users/john/statuses/20", "https://host2/users/john/statuses/30"}, objects())
+	// the next poll continues from the cursor, the sensitive status is not published
+	reqs = nil
+	n, err = svc.PollTags(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), n)
+	assert.Equal(t, []string{"/api/v1/timelines/tag/go min_id=30", "/api/v1/timelines/tag/go min_id=32", "/api/v1/timelines/tag/golang min_id="}, reqs)
+	assert.Equal(t, []string{"https://host2/users/john/statuses/32"}, objects())
+	id, err := stor.Cursor(context.TODO(), cfg.Client.Hosts[0], cursorKeyTag("go"))
+	require.NoError(t, err)
+	assert.Equal(t, "32", id)
+	// unfollowed
+	tags, err = svc.FollowTags(context.TODO(), "interest1", nil)
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+	id, err = stor.Cursor(context.TODO(), cfg.Client.Hosts[0], cursorKeyTag("go"))
+	require.NoError(t, err)
+	assert.Equal(t, "", id)
+	reqs = nil
+	n, err = svc.PollTags(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), n)
+	assert.Empty(t, reqs)
+}
+
+func TestMastodon_PollTags_Partial(t *testing.T) {
+	st := func(id string) string {
+		return `{"id":"` + id + `","visibility":"public","uri":"https://host2/users/john/statuses/` + id + `","content":"<p>#go</p>",` +
+			`"account":{"id":"100","acct":"john@host2","uri":"https://host2/users/john","discoverable":true}}`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("min_id") {
+		case "10":
+			w.Header().Set("Link", `<http://`+r.Host+r.URL.Path+`?min_id=30>; rel="prev"`)
+			_, _ = w.Write([]byte(`[` + st("30") + `,` + st("20") + `]`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	cfg := config.MastodonConfig{}
+	cfg.Client.Hosts = []string{strings.TrimPrefix(srv.URL, "http://")}
+	cfg.Client.Tokens = []string{"token1"}
+	cfg.Endpoint.Protocol = "http://"
+	cfg.Endpoint.Tags = "/api/v1/timelines/tag"
+	cfg.Stream.IndexSize = 10
+	cfg.Tags.Limit = 2
+	cfg.Tags.PagesMax = 5
+	svcPub := &pubRecorder{}
+	stor := storage.NewStorageMemory(0)
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), svcPub, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), stor, slog.Default())
+	_, err := svc.FollowTags(context.TODO(), "interest1", []string{"#go"})
+	require.NoError(t, err)
+	require.NoError(t, stor.PutCursor(context.TODO(), model.Cursor{Host: cfg.Client.Hosts[0], Key: cursorKeyTag("go"), Id: "10"}))
+	// the 2nd page fails, the 1st one is handled anyway
+	n, err := svc.PollTags(context.TODO())
+	assert.Error(t, err)
+	assert.Equal(t, uint32(2), n)
+	assert.Len(t, svcPub.evts, 2)
+	// the cursor doesn't go beyond the last page fetched
+	id, err := stor.Cursor(context.TODO(), cfg.Client.Hosts[0], cursorKeyTag("go"))
+	require.NoError(t, err)
+	assert.Equal(t, "30", id)
+}
+
+func TestMastodon_FollowTags_Concurrent(t *testing.T) {
+	cfg := config.MastodonConfig{}
+	cfg.Client.Hosts = []string{"host1"}
+	cfg.Client.Tokens = []string{"token1"}
+	stor := storage.NewStorageMemory(0)
+	svc := NewService(newTestClient(cfg), cfg, ap.NewServiceMock(), &pubRecorder{}, "type1", "type1_delete", newTestPolicy(cfg), newTestInstances(cfg), stor, slog.Default())
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			interestId := fmt.Sprintf("interest%d", i)
+			tag := fmt.Sprintf("tag%d", i)
+			_, err := svc.FollowTags(context.TODO(), interestId, []string{"#" + tag})
+			assert.NoError(t, err)
+			assert.NoError(t, stor.PutCursor(context.TODO(), model.Cursor{Host: "host1", Key: cursorKeyTag(tag), Id: "1"}))
+			_, err = svc.FollowTags(context.TODO(), interestId, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	// every hashtag is not followed anymore, so every cursor is forgotten
+	tags, err := stor.ListTags(context.TODO())
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+	for i := 0; i < 10; i++ {
+		id, err := stor.Cursor(context.TODO(), "host1", cursorKeyTag(fmt.Sprintf("tag%d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, "", id, "tag%d", i)
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"github.com/awakari/int-mastodon/model"
+	"github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	"net/url"
+	"strings"
+)
+
+// convertThread sets the reply and quote attributes and returns the conversation, i.e. the URI of the thread root.
+// The status ids in the reply are local to the source host, so the parent status URI is known only when the parent
+// has been published recently. Otherwise, the parent status address on the source host is used. The conversation is
+// known only for the thread root and for the replies to the recently published statuses.
+func (m mastodon) convertThread(attrs map[string]*pb.CloudEventAttributeValue, st model.Status, src string, recent map[string]indexItem) (conversation string) {
+	switch st.InReplyToId {
+	case "":
+		conversation = st.Uri
+	default:
+		host := hostOf(src)
+		acct := inReplyToAcct(st, host)
+		parent, found := m.lookupPublished(publishedKey(src, st.InReplyToId), recent)
+		switch {
+		case found && parent.uri != "":
+			setUri(attrs, model.CeKeyInReplyTo, parent.uri)
+			conversation = parent.conversation
+		case acct != "" && host != "":
+			// the local accounts are addressed by the bare username on their own host
+			acctPath := strings.TrimSuffix(acct, "@"+host)
+			setUri(attrs, model.CeKeyInReplyTo, m.cfg.Endpoint.Protocol+host+"/@"+acctPath+"/"+st.InReplyToId)
+		}
+		setString(attrs, model.CeKeyInReplyToAccount, acct)
+	}
+	setString(attrs, model.CeKeyConversation, conversation)
+	if quoted := st.Quote.Quoted(); quoted != nil {
+		setUri(attrs, model.CeKeyQuote, quoted.Uri)
+	}
+	return
+}
+
+// inReplyToAcct returns the address of the replied account, e.g. "john@host2".
+func inReplyToAcct(st model.Status, host string) (acct string) {
+	switch st.InReplyToAccountId {
+	case "":
+	case st.Account.Id:
+		acct = st.Account.Acct
+	default:
+		for _, mention := range st.Mentions {
+			if mention.Id == st.InReplyToAccountId {
+				acct = mention.Acct
+				break
+			}
+		}
+	}
+	// local account
+	if acct != "" && !strings.Contains(acct, "@") && host != "" {
+		acct += "@" + host
+	}
+	return
+}
+
+func hostOf(src string) (host string) {
+	u, err := url.Parse(src)
+	if err == nil {
+		host = u.Host
+	}
+	return
+}
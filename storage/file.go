@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/bytedance/sonic"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// file keeps the sources, the cursors and the hashtags in memory and appends every change as a JSON line to the file.
+// The file is replayed and compacted when opened, the compaction drops the expired rejected and failed sources.
+type file struct {
+	mem  memory
+	lock *sync.Mutex
+	f    *os.File
+}
+
+// fileRecord is the single line of the file, either put or delete of the source, the cursor or the hashtags.
+type fileRecord struct {
+	Put           *model.Source       `json:"put,omitempty"`
+	Delete        *model.SourceFilter `json:"delete,omitempty"`
+	PutCursor     *model.Cursor       `json:"putCursor,omitempty"`
+	DeleteCursors *string             `json:"deleteCursors,omitempty"`
+	PutTags       *model.InterestTags `json:"putTags,omitempty"`
+}
+
+const limitFileLineLen = 1_048_576
+
+func NewStorageFile(path string, ttlRejected time.Duration) (stor Storage, err error) {
+	mem := newMemory(ttlRejected)
+	err = replay(path, mem)
+	if err == nil {
+		mem.lock.Lock()
+		*mem.expired = time.Time{}
+		mem.expire(time.Now())
+		mem.lock.Unlock()
+		err = compact(path, mem)
+	}
+	var f *os.File
+	if err == nil {
+		f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	}
+	if err == nil {
+		stor = file{
+			mem:  mem,
+			lock: &sync.Mutex{},
+			f:    f,
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to open the sources storage file %s: %w", path, err)
+	}
+	return
+}
+
+func (s file) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.f.Close()
+}
+
+func (s file) Put(ctx context.Context, src model.Source) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err = s.append(fileRecord{Put: &src})
+	if err == nil {
+		err = s.mem.Put(ctx, src)
+	}
+	return
+}
+
+func (s file) List(ctx context.Context, filter model.SourceFilter) (srcs []model.Source, err error) {
+	return s.mem.List(ctx, filter)
+}
+
+func (s file) Delete(ctx context.Context, filter model.SourceFilter) (n int, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err = s.append(fileRecord{Delete: &filter})
+	if err == nil {
+		n, err = s.mem.Delete(ctx, filter)
+	}
+	return
+}
+
+func (s file) Cursor(ctx context.Context, host, key string) (id string, err error) {
+	return s.mem.Cursor(ctx, host, key)
+}
+
+func (s file) PutCursor(ctx context.Context, c model.Cursor) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err = s.append(fileRecord{PutCursor: &c})
+	if err == nil {
+		err = s.mem.PutCursor(ctx, c)
+	}
+	return
+}
+
+func (s file) DeleteCursors(ctx context.Context, keyPrefix string) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err = s.append(fileRecord{DeleteCursors: &keyPrefix})
+	if err == nil {
+		err = s.mem.DeleteCursors(ctx, keyPrefix)
+	}
+	return
+}
+
+func (s file) PutTags(ctx context.Context, it model.InterestTags) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err = s.append(fileRecord{PutTags: &it})
+	if err == nil {
+		err = s.mem.PutTags(ctx, it)
+	}
+	return
+}
+
+func (s file) ListTags(ctx context.Context) (tags []string, err error) {
+	return s.mem.ListTags(ctx)
+}
+
+func (s file) append(rec fileRecord) (err error) {
+	var data []byte
+	data, err = sonic.Marshal(rec)
+	if err == nil {
+		_, err = s.f.Write(append(data, '\n'))
+	}
+	return
+}
+
+func replay(path string, mem memory) (err error) {
+	var f *os.File
+	f, err = os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), limitFileLineLen)
+		// the last line missing the line break was not appended completely
+		var lineIncomplete bool
+		scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+			advance, token, err = bufio.ScanLines(data, atEOF)
+			lineIncomplete = atEOF && len(data) > 0 && advance == len(data) && data[len(data)-1] != '\n'
+			return
+		})
+		for err == nil && scanner.Scan() {
+			var rec fileRecord
+			err = sonic.Unmarshal(scanner.Bytes(), &rec)
+			switch {
+			case err != nil && lineIncomplete:
+				// torn by a crash while appending, skip it and the compaction drops it
+				err = nil
+			case err != nil:
+			case rec.Put != nil:
+				err = mem.Put(context.TODO(), *rec.Put)
+			case rec.Delete != nil:
+				_, err = mem.Delete(context.TODO(), *rec.Delete)
+			case rec.PutCursor != nil:
+				err = mem.PutCursor(context.TODO(), *rec.PutCursor)
+			case rec.DeleteCursors != nil:
+				err = mem.DeleteCursors(context.TODO(), *rec.DeleteCursors)
+			case rec.PutTags != nil:
+				err = mem.PutTags(context.TODO(), *rec.PutTags)
+			}
+		}
+		if err == nil {
+			err = scanner.Err()
+		}
+	}
+	return
+}
+
+// compact rewrites the file keeping only the current sources, cursors and hashtags.
+func compact(path string, mem memory) (err error) {
+	var recs []fileRecord
+	var srcs []model.Source
+	srcs, err = mem.List(context.TODO(), model.SourceFilter{})
+	for _, src := range srcs {
+		recs = append(recs, fileRecord{Put: &src})
+	}
+	for _, c := range mem.listCursors() {
+		recs = append(recs, fileRecord{PutCursor: &c})
+	}
+	for _, it := range mem.listInterestTags() {
+		recs = append(recs, fileRecord{PutTags: &it})
+	}
+	var f *os.File
+	if err == nil {
+		f, err = os.Create(path + ".tmp")
+	}
+	if err == nil {
+		w := bufio.NewWriter(f)
+		for _, rec := range recs {
+			var data []byte
+			data, err = sonic.Marshal(rec)
+			if err == nil {
+				_, err = w.Write(append(data, '\n'))
+			}
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		err = errors.Join(err, f.Close())
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	return
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sources.jsonl")
+	stor, err := NewStorageFile(path, 0)
+	require.NoError(t, err)
+	testStorage(t, stor)
+	require.NoError(t, stor.Close())
+	// reopen
+	stor, err = NewStorageFile(path, 0)
+	require.NoError(t, err)
+	defer stor.Close()
+	actual, err := stor.List(context.TODO(), model.SourceFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Source{
+		{
+			AccountUri: "https://host2/users/john",
+			InterestId: "interest2",
+			Time:       time.Date(2024, 12, 20, 10, 40, 17, 0, time.UTC),
+			Outcome:    model.SourceOutcomeDelegated,
+		},
+	}, actual)
+	id, err := stor.Cursor(context.TODO(), "host1", "key2")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", id)
+	tags, err := stor.ListTags(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"baz", "foo"}, tags)
+	// compacted
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(data), "\n"))
+}
+
+func TestFile_ExpireRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sources.jsonl")
+	stor, err := NewStorageFile(path, 0)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	srcs := []model.Source{
+		{
+			AccountUri: "https://host2/users/john",
+			InterestId: "interest1",
+			Time:       now.Add(-2 * time.Hour),
+			Outcome:    model.SourceOutcomeDelegated,
+		},
+		{
+			AccountUri: "https://host2/users/jane",
+			InterestId: "interest1",
+			Time:       now.Add(-2 * time.Hour),
+			Outcome:    model.SourceOutcomeRejected,
+		},
+		{
+			AccountUri: "https://host2/users/jack",
+			InterestId: "interest1",
+			Time:       now,
+			Outcome:    model.SourceOutcomeFailed,
+		},
+	}
+	for _, src := range srcs {
+		require.NoError(t, stor.Put(context.TODO(), src))
+	}
+	require.NoError(t, stor.Close())
+	// reopen with the TTL
+	stor, err = NewStorageFile(path, time.Hour)
+	require.NoError(t, err)
+	defer stor.Close()
+	actual, err := stor.List(context.TODO(), model.SourceFilter{})
+	assert.NoError(t, err)
+	require.Equal(t, 2, len(actual))
+	assert.Equal(t, srcs[0].AccountUri, actual[0].AccountUri)
+	assert.Equal(t, srcs[2].AccountUri, actual[1].AccountUri)
+	// compacted
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+}
+
+func TestFile_Corrupted(t *testing.T) {
+	lineValid := `{"putTags":{"interestId":"interest1","tags":["foo"]}}`
+	cases := map[string]struct {
+		data string
+		tags []string
+		err  bool
+	}{
+		"corrupted line": {
+			data: "{\n",
+			err:  true,
+		},
+		"corrupted in the middle": {
+			data: "{\n" + lineValid + "\n",
+			err:  true,
+		},
+		"torn tail": {
+			data: lineValid + "\n" + `{"putTags":{"inter`,
+			tags: []string{"foo"},
+		},
+		"complete tail without line break": {
+			data: lineValid,
+			tags: []string{"foo"},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sources.jsonl")
+			require.NoError(t, os.WriteFile(path, []byte(c.data), 0644))
+			stor, err := NewStorageFile(path, 0)
+			if c.err {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				defer stor.Close()
+				tags, err := stor.ListTags(context.TODO())
+				assert.NoError(t, err)
+				assert.Equal(t, c.tags, tags)
+				// the torn tail is dropped by the compaction
+				data, err := os.ReadFile(path)
+				require.NoError(t, err)
+				assert.Equal(t, lineValid+"\n", string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"github.com/awakari/int-mastodon/model"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memory struct {
+	lock    *sync.Mutex
+	srcs    map[key]model.Source
+	cursors map[cursorKey]model.Cursor
+	tags    map[string][]string
+	// ttlRejected is the time to keep the rejected and failed sources, forever when zero
+	ttlRejected time.Duration
+	// expired is the time the rejected and failed sources were removed last time
+	expired *time.Time
+}
+
+type key struct {
+	interestId string
+	host       string
+	accountUri string
+}
+
+type cursorKey struct {
+	host string
+	key  string
+}
+
+// NewStorageMemory returns the storage removing the rejected and failed sources older than ttlRejected.
+func NewStorageMemory(ttlRejected time.Duration) Storage {
+	return newMemory(ttlRejected)
+}
+
+func newMemory(ttlRejected time.Duration) memory {
+	return memory{
+		lock:        &sync.Mutex{},
+		srcs:        make(map[key]model.Source),
+		cursors:     make(map[cursorKey]model.Cursor),
+		tags:        make(map[string][]string),
+		ttlRejected: ttlRejected,
+		expired:     &time.Time{},
+	}
+}
+
+func (m memory) Close() error {
+	return nil
+}
+
+func (m memory) Put(ctx context.Context, src model.Source) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.srcs[keyOf(src)] = src
+	m.expire(time.Now())
+	return
+}
+
+// expire removes the rejected and failed sources older than the TTL.
+// Runs not more often than every tenth of the TTL, so the sources are kept not longer than 1.1 of the TTL.
+// Not thread safe, should be called under the lock.
+func (m memory) expire(now time.Time) {
+	if m.ttlRejected <= 0 || now.Sub(*m.expired) < m.ttlRejected/10 {
+		return
+	}
+	*m.expired = now
+	for k, src := range m.srcs {
+		if !src.Outcome.Added() && now.Sub(src.Time) > m.ttlRejected {
+			delete(m.srcs, k)
+		}
+	}
+}
+
+func (m memory) List(ctx context.Context, filter model.SourceFilter) (srcs []model.Source, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, src := range m.srcs {
+		if filter.Match(src) {
+			srcs = append(srcs, src)
+		}
+	}
+	sort.Slice(srcs, func(i, j int) bool {
+		if !srcs[i].Time.Equal(srcs[j].Time) {
+			return srcs[i].Time.Before(srcs[j].Time)
+		}
+		// stable order of the sources having the same time
+		return keyOf(srcs[i]).less(keyOf(srcs[j]))
+	})
+	return
+}
+
+func (m memory) Delete(ctx context.Context, filter model.SourceFilter) (n int, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for k, src := range m.srcs {
+		if filter.Match(src) {
+			delete(m.srcs, k)
+			n++
+		}
+	}
+	return
+}
+
+func (m memory) Cursor(ctx context.Context, host, key string) (id string, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	id = m.cursors[cursorKey{host: host, key: key}].Id
+	return
+}
+
+func (m memory) PutCursor(ctx context.Context, c model.Cursor) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.cursors[cursorKey{host: c.Host, key: c.Key}] = c
+	return
+}
+
+func (m memory) DeleteCursors(ctx context.Context, keyPrefix string) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for k := range m.cursors {
+		if strings.HasPrefix(k.key, keyPrefix) {
+			delete(m.cursors, k)
+		}
+	}
+	return
+}
+
+// listCursors returns every cursor ordered by the host and key.
+func (m memory) listCursors() (cursors []model.Cursor) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, c := range m.cursors {
+		cursors = append(cursors, c)
+	}
+	sort.Slice(cursors, func(i, j int) bool {
+		return cursors[i].Host < cursors[j].Host || (cursors[i].Host == cursors[j].Host && cursors[i].Key < cursors[j].Key)
+	})
+	return
+}
+
+func (m memory) PutTags(ctx context.Context, it model.InterestTags) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	switch len(it.Tags) {
+	case 0:
+		delete(m.tags, it.InterestId)
+	default:
+		m.tags[it.InterestId] = it.Tags
+	}
+	return
+}
+
+func (m memory) ListTags(ctx context.Context) (tags []string, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, interestTags := range m.tags {
+		tags = append(tags, interestTags...)
+	}
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+	return
+}
+
+// listInterestTags returns the hashtags of every interest ordered by the interest id.
+func (m memory) listInterestTags() (its []model.InterestTags) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for interestId, tags := range m.tags {
+		its = append(its, model.InterestTags{
+			InterestId: interestId,
+			Tags:       tags,
+		})
+	}
+	sort.Slice(its, func(i, j int) bool {
+		return its[i].InterestId < its[j].InterestId
+	})
+	return
+}
+
+func keyOf(src model.Source) key {
+	return key{
+		interestId: src.InterestId,
+		host:       src.Host,
+		accountUri: src.AccountUri,
+	}
+}
+
+func (k key) less(other key) bool {
+	switch {
+	case k.interestId != other.interestId:
+		return k.interestId < other.interestId
+	case k.host != other.host:
+		return k.host < other.host
+	}
+	return k.accountUri < other.accountUri
+}
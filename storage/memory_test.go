@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"github.com/awakari/int-mastodon/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	testStorage(t, NewStorageMemory(0))
+}
+
+func TestMemory_List_SameTime(t *testing.T) {
+	stor := NewStorageMemory(0)
+	t0 := time.Date(2024, 12, 20, 10, 40, 15, 0, time.UTC)
+	srcs := []model.Source{
+		{
+			AccountUri: "https://host2/users/john",
+			InterestId: "interest2",
+			Time:       t0,
+		},
+		{
+			AccountUri: "https://host2/users/john",
+			Host:       "host1",
+			InterestId: "interest1",
+			Time:       t0,
+		},
+		{
+			AccountUri: "https://host2/users/jane",
+			InterestId: "interest1",
+			Time:       t0,
+		},
+		{
+			AccountUri: "https://host2/users/jim",
+			InterestId: "interest3",
+			Time:       t0.Add(-time.Second),
+		},
+	}
+	for _, src := range srcs {
+		require.NoError(t, stor.Put(context.TODO(), src))
+	}
+	for range 10 {
+		actual, err := stor.List(context.TODO(), model.SourceFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []model.Source{srcs[3], srcs[2], srcs[1], srcs[0]}, actual)
+	}
+}
+
+func TestMemory_Put_ExpireRejected(t *testing.T) {
+	stor := NewStorageMemory(time.Hour)
+	now := time.Now()
+	srcs := []model.Source{
+		{
+			AccountUri: "https://host2/users/john",
+			InterestId: "interest1",
+			Time:       now.Add(-2 * time.Hour),
+			Outcome:    model.SourceOutcomeDelegated,
+		},
+		{
+			AccountUri: "https://host2/users/jane",
+			InterestId: "interest1",
+			Time:       now.Add(-2 * time.Hour),
+			Outcome:    model.SourceOutcomeRejected,
+		},
+		{
+			AccountUri: "https://host2/users/jim",
+			InterestId: "interest1",
+			Time:       now.Add(-2 * time.Hour),
+			Outcome:    model.SourceOutcomeFailed,
+		},
+		{
+			AccountUri: "https://host2/users/jack",
+			InterestId: "interest1",
+			Time:       now,
+			Outcome:    model.SourceOutcomeRejected,
+		},
+	}
+	for _, src := range srcs {
+		require.NoError(t, stor.Put(context.TODO(), src))
+	}
+	actual, err := stor.List(context.TODO(), model.SourceFilter{})
+	require.NoError(t, err)
+	// the first put expires nothing yet, the next ones are within the tenth of the TTL
+	assert.Equal(t, 4, len(actual))
+	m := stor.(memory)
+	*m.expired = time.Time{}
+	require.NoError(t, stor.Put(context.TODO(), srcs[3]))
+	actual, err = stor.List(context.TODO(), model.SourceFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []model.Source{srcs[0], srcs[3]}, actual)
+}
+
+func testStorage(t *testing.T, stor Storage) {
+	ctx := context.TODO()
+	t0 := time.Date(2024, 12, 20, 10, 40, 15, 0, time.UTC)
+	srcs := []model.Source{
+		{
+			AccountUri: "https://host2/users/john",
+			InterestId: "interest1",
+			Time:       t0,
+			Outcome:    model.SourceOutcomeDelegated,
+		},
+		{
+			AccountUri: "https://host2/users/jane",
+			InterestId: "interest1",
+			Time:       t0.Add(time.Second),
+			Outcome:    model.SourceOutcomeRejected,
+			Decision:   model.Reject(model.ReasonNotDiscoverable, "no explicit discoverable flag set"),
+		},
+		{
+			AccountUri: "https://host2/users/john",
+			InterestId: "interest2",
+			Time:       t0.Add(2 * time.Second),
+			Outcome:    model.SourceOutcomeDelegated,
+		},
+		{
+			AccountUri: "https://ap.host/actor/interest1",
+			Host:       "host1",
+			InterestId: "interest1",
+			Time:       t0.Add(3 * time.Second),
+			Outcome:    model.SourceOutcomeFollowed,
+		},
+	}
+	for _, src := range srcs {
+		require.NoError(t, stor.Put(ctx, src))
+	}
+	// replace
+	srcs[1].Outcome = model.SourceOutcomeDelegated
+	require.NoError(t, stor.Put(ctx, srcs[1]))
+	//
+	cases := map[string]struct {
+		filter   model.SourceFilter
+		expected []model.Source
+	}{
+		"all": {
+			expected: srcs,
+		},
+		"interest": {
+			filter: model.SourceFilter{
+				InterestId: "interest1",
+			},
+			expected: []model.Source{srcs[0], srcs[1], srcs[3]},
+		},
+		"account": {
+			filter: model.SourceFilter{
+				AccountUri: "https://host2/users/john",
+			},
+			expected: []model.Source{srcs[0], srcs[2]},
+		},
+		"host": {
+			filter: model.SourceFilter{
+				Host:       "host1",
+				InterestId: "interest1",
+			},
+			expected: []model.Source{srcs[3]},
+		},
+		"none": {
+			filter: model.SourceFilter{
+				InterestId: "interest3",
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			actual, err := stor.List(ctx, c.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, actual)
+		})
+	}
+	//
+	n, err := stor.Delete(ctx, model.SourceFilter{InterestId: "interest1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	actual, err := stor.List(ctx, model.SourceFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Source{srcs[2]}, actual)
+	//
+	for _, c := range []model.Cursor{
+		{Host: "host1", Key: "key1", Id: "110"},
+		{Host: "host2", Key: "key1", Id: "9"},
+		{Host: "host1", Key: "key2", Id: "7"},
+		{Host: "host1", Key: "key1", Id: "111"},
+	} {
+		require.NoError(t, stor.PutCursor(ctx, c))
+	}
+	id, err := stor.Cursor(ctx, "host1", "key1")
+	assert.NoError(t, err)
+	assert.Equal(t, "111", id)
+	id, err = stor.Cursor(ctx, "host2", "key2")
+	assert.NoError(t, err)
+	assert.Equal(t, "", id)
+	require.NoError(t, stor.PutCursor(ctx, model.Cursor{Host: "host1", Key: "key10", Id: "5"}))
+	// by the prefix
+	require.NoError(t, stor.DeleteCursors(ctx, "key1"))
+	id, err = stor.Cursor(ctx, "host2", "key1")
+	assert.NoError(t, err)
+	assert.Equal(t, "", id)
+	id, err = stor.Cursor(ctx, "host1", "key10")
+	assert.NoError(t, err)
+	assert.Equal(t, "", id)
+	id, err = stor.Cursor(ctx, "host1", "key2")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", id)
+	//
+	require.NoError(t, stor.PutTags(ctx, model.InterestTags{InterestId: "interest1", Tags: []string{"foo", "bar"}}))
+	require.NoError(t, stor.PutTags(ctx, model.InterestTags{InterestId: "interest2", Tags: []string{"foo"}}))
+	require.NoError(t, stor.PutTags(ctx, model.InterestTags{InterestId: "interest3", Tags: []string{"baz"}}))
+	require.NoError(t, stor.PutTags(ctx, model.InterestTags{InterestId: "interest1"}))
+	tags, err := stor.ListTags(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"baz", "foo"}, tags)
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"github.com/awakari/int-mastodon/model"
+	"io"
+)
+
+// Storage keeps the decisions made about the accounts found for the interests, so it's possible to tell why the
+// source is added, to avoid adding it again and to remove it when not needed anymore. Also keeps the cursors and the
+// hashtags followed, so the polling resumes after the restart.
+type Storage interface {
+	io.Closer
+
+	// Put creates or replaces the source identified by the interest id, host and account URI.
+	Put(ctx context.Context, src model.Source) (err error)
+
+	// List returns the sources matching the filter ordered by the time.
+	List(ctx context.Context, filter model.SourceFilter) (srcs []model.Source, err error)
+
+	// Delete removes the sources matching the filter. Returns the count of removed sources.
+	Delete(ctx context.Context, filter model.SourceFilter) (n int, err error)
+
+	// Cursor returns the id of the newest status fetched before on the host for the key, empty if none.
+	Cursor(ctx context.Context, host, key string) (id string, err error)
+
+	// PutCursor creates or replaces the cursor identified by the host and key.
+	PutCursor(ctx context.Context, c model.Cursor) (err error)
+
+	// DeleteCursors removes the cursors having the key starting with the prefix on every host.
+	DeleteCursors(ctx context.Context, keyPrefix string) (err error)
+
+	// PutTags replaces the hashtags followed for the interest, the empty tags stop following.
+	PutTags(ctx context.Context, it model.InterestTags) (err error)
+
+	// ListTags returns the hashtags followed for any interest, sorted and without duplicates.
+	ListTags(ctx context.Context) (tags []string, err error)
+}
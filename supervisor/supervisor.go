@@ -0,0 +1,76 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/int-mastodon/util"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Task runs until the context is done or fails. The returned error is logged and the task is restarted.
+type Task func(ctx context.Context) (err error)
+
+type Supervisor interface {
+
+	// Go runs the task in background until the context is done, restarting it after the backoff when it returns.
+	Go(name string, task Task)
+
+	// Wait blocks until all the tasks are finished after the context is done, but not longer than the timeout.
+	Wait(timeout time.Duration) (err error)
+}
+
+type supervisor struct {
+	ctx     context.Context
+	backoff time.Duration
+	log     *slog.Logger
+	wg      *sync.WaitGroup
+}
+
+var ErrTimeout = errors.New("timeout waiting for the tasks to finish")
+
+func NewSupervisor(ctx context.Context, backoff time.Duration, log *slog.Logger) Supervisor {
+	return supervisor{
+		ctx:     ctx,
+		backoff: backoff,
+		log:     log,
+		wg:      &sync.WaitGroup{},
+	}
+}
+
+func (s supervisor) Go(name string, task Task) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			err := task(s.ctx)
+			if s.ctx.Err() != nil {
+				s.log.Info(fmt.Sprintf("supervisor: task %s stopped", name))
+				return
+			}
+			s.log.Log(s.ctx, util.LogLevel(err), fmt.Sprintf("supervisor: task %s returned, restarting in %s: err=%s", name, s.backoff, err))
+			select {
+			case <-s.ctx.Done():
+				s.log.Info(fmt.Sprintf("supervisor: task %s stopped", name))
+				return
+			case <-time.After(s.backoff):
+			}
+		}
+	}()
+}
+
+func (s supervisor) Wait(timeout time.Duration) (err error) {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		err = ErrTimeout
+	}
+	return
+}
@@ -0,0 +1,48 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSupervisor_Go(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	sv := NewSupervisor(ctx, time.Millisecond, slog.Default())
+	var runs atomic.Int32
+	var drained atomic.Bool
+	sv.Go("task1", func(ctx context.Context) (err error) {
+		if runs.Add(1) < 3 {
+			return errors.New("fail")
+		}
+		<-ctx.Done()
+		// drain
+		time.Sleep(10 * time.Millisecond)
+		drained.Store(true)
+		return ctx.Err()
+	})
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(3), runs.Load())
+	cancel()
+	err := sv.Wait(time.Second)
+	assert.NoError(t, err)
+	assert.True(t, drained.Load())
+	assert.Equal(t, int32(3), runs.Load())
+}
+
+func TestSupervisor_Wait_Timeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	sv := NewSupervisor(ctx, time.Millisecond, slog.Default())
+	sv.Go("task1", func(ctx context.Context) (err error) {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		return
+	})
+	cancel()
+	err := sv.Wait(10 * time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeout)
+}